@@ -0,0 +1,5 @@
+// Package marlinpb contains the protocol buffer messages and gRPC service
+// definitions of the marlin API.
+package marlinpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative marlin.proto
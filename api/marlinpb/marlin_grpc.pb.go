@@ -0,0 +1,250 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: marlin.proto
+
+package marlinpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	Marlin_GetHistorical_FullMethodName    = "/marlin.v1.Marlin/GetHistorical"
+	Marlin_GetLatest_FullMethodName        = "/marlin.v1.Marlin/GetLatest"
+	Marlin_GetExchangeInfo_FullMethodName  = "/marlin.v1.Marlin/GetExchangeInfo"
+	Marlin_SubscribeCandles_FullMethodName = "/marlin.v1.Marlin/SubscribeCandles"
+)
+
+// MarlinClient is the client API for Marlin service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type MarlinClient interface {
+	GetHistorical(ctx context.Context, in *GetHistoricalRequest, opts ...grpc.CallOption) (*CandlesResponse, error)
+	GetLatest(ctx context.Context, in *GetLatestRequest, opts ...grpc.CallOption) (*CandlesResponse, error)
+	GetExchangeInfo(ctx context.Context, in *GetExchangeInfoRequest, opts ...grpc.CallOption) (*ExchangeList, error)
+	// SubscribeCandles streams closed candles as they become available upstream.
+	SubscribeCandles(ctx context.Context, in *SubscribeCandlesRequest, opts ...grpc.CallOption) (Marlin_SubscribeCandlesClient, error)
+}
+
+type marlinClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewMarlinClient(cc grpc.ClientConnInterface) MarlinClient {
+	return &marlinClient{cc}
+}
+
+func (c *marlinClient) GetHistorical(ctx context.Context, in *GetHistoricalRequest, opts ...grpc.CallOption) (*CandlesResponse, error) {
+	out := new(CandlesResponse)
+	err := c.cc.Invoke(ctx, Marlin_GetHistorical_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *marlinClient) GetLatest(ctx context.Context, in *GetLatestRequest, opts ...grpc.CallOption) (*CandlesResponse, error) {
+	out := new(CandlesResponse)
+	err := c.cc.Invoke(ctx, Marlin_GetLatest_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *marlinClient) GetExchangeInfo(ctx context.Context, in *GetExchangeInfoRequest, opts ...grpc.CallOption) (*ExchangeList, error) {
+	out := new(ExchangeList)
+	err := c.cc.Invoke(ctx, Marlin_GetExchangeInfo_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *marlinClient) SubscribeCandles(ctx context.Context, in *SubscribeCandlesRequest, opts ...grpc.CallOption) (Marlin_SubscribeCandlesClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Marlin_ServiceDesc.Streams[0], Marlin_SubscribeCandles_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &marlinSubscribeCandlesClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Marlin_SubscribeCandlesClient interface {
+	Recv() (*Candle, error)
+	grpc.ClientStream
+}
+
+type marlinSubscribeCandlesClient struct {
+	grpc.ClientStream
+}
+
+func (x *marlinSubscribeCandlesClient) Recv() (*Candle, error) {
+	m := new(Candle)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// MarlinServer is the server API for Marlin service.
+// All implementations must embed UnimplementedMarlinServer
+// for forward compatibility
+type MarlinServer interface {
+	GetHistorical(context.Context, *GetHistoricalRequest) (*CandlesResponse, error)
+	GetLatest(context.Context, *GetLatestRequest) (*CandlesResponse, error)
+	GetExchangeInfo(context.Context, *GetExchangeInfoRequest) (*ExchangeList, error)
+	// SubscribeCandles streams closed candles as they become available upstream.
+	SubscribeCandles(*SubscribeCandlesRequest, Marlin_SubscribeCandlesServer) error
+	mustEmbedUnimplementedMarlinServer()
+}
+
+// UnimplementedMarlinServer must be embedded to have forward compatible implementations.
+type UnimplementedMarlinServer struct {
+}
+
+func (UnimplementedMarlinServer) GetHistorical(context.Context, *GetHistoricalRequest) (*CandlesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetHistorical not implemented")
+}
+func (UnimplementedMarlinServer) GetLatest(context.Context, *GetLatestRequest) (*CandlesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetLatest not implemented")
+}
+func (UnimplementedMarlinServer) GetExchangeInfo(context.Context, *GetExchangeInfoRequest) (*ExchangeList, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetExchangeInfo not implemented")
+}
+func (UnimplementedMarlinServer) SubscribeCandles(*SubscribeCandlesRequest, Marlin_SubscribeCandlesServer) error {
+	return status.Errorf(codes.Unimplemented, "method SubscribeCandles not implemented")
+}
+func (UnimplementedMarlinServer) mustEmbedUnimplementedMarlinServer() {}
+
+// UnsafeMarlinServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to MarlinServer will
+// result in compilation errors.
+type UnsafeMarlinServer interface {
+	mustEmbedUnimplementedMarlinServer()
+}
+
+func RegisterMarlinServer(s grpc.ServiceRegistrar, srv MarlinServer) {
+	s.RegisterService(&Marlin_ServiceDesc, srv)
+}
+
+func _Marlin_GetHistorical_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetHistoricalRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MarlinServer).GetHistorical(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Marlin_GetHistorical_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MarlinServer).GetHistorical(ctx, req.(*GetHistoricalRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Marlin_GetLatest_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetLatestRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MarlinServer).GetLatest(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Marlin_GetLatest_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MarlinServer).GetLatest(ctx, req.(*GetLatestRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Marlin_GetExchangeInfo_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetExchangeInfoRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MarlinServer).GetExchangeInfo(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Marlin_GetExchangeInfo_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MarlinServer).GetExchangeInfo(ctx, req.(*GetExchangeInfoRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Marlin_SubscribeCandles_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(SubscribeCandlesRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(MarlinServer).SubscribeCandles(m, &marlinSubscribeCandlesServer{stream})
+}
+
+type Marlin_SubscribeCandlesServer interface {
+	Send(*Candle) error
+	grpc.ServerStream
+}
+
+type marlinSubscribeCandlesServer struct {
+	grpc.ServerStream
+}
+
+func (x *marlinSubscribeCandlesServer) Send(m *Candle) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// Marlin_ServiceDesc is the grpc.ServiceDesc for Marlin service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Marlin_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "marlin.v1.Marlin",
+	HandlerType: (*MarlinServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetHistorical",
+			Handler:    _Marlin_GetHistorical_Handler,
+		},
+		{
+			MethodName: "GetLatest",
+			Handler:    _Marlin_GetLatest_Handler,
+		},
+		{
+			MethodName: "GetExchangeInfo",
+			Handler:    _Marlin_GetExchangeInfo_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "SubscribeCandles",
+			Handler:       _Marlin_SubscribeCandles_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "marlin.proto",
+}
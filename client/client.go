@@ -0,0 +1,231 @@
+// Package client implements a typed client for the marlin REST API.
+package client
+
+import (
+	"context"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"github.com/godoji/candlestick"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Format int
+
+const (
+	FormatGob Format = iota
+	FormatJSON
+)
+
+// APIError is returned when the service answers with a non successful status
+type APIError struct {
+	StatusCode int    `json:"-"`
+	Code       string `json:"code"`
+	Message    string `json:"message"`
+	Kind       int    `json:"kind"`
+	RequestId  string `json:"requestId"`
+	RetryAfter int64  `json:"retryAfter"`
+	Broker     string `json:"broker"`
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("marlin: %d %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+type errorEnvelope struct {
+	Error APIError `json:"error"`
+}
+
+func decodeError(res *http.Response) *APIError {
+	envelope := new(errorEnvelope)
+	var err error
+	if strings.HasPrefix(res.Header.Get("Content-Type"), "application/octet-stream") {
+		err = gob.NewDecoder(res.Body).Decode(envelope)
+	} else {
+		err = json.NewDecoder(io.LimitReader(res.Body, 64*1024)).Decode(envelope)
+	}
+	if err != nil {
+		return &APIError{StatusCode: res.StatusCode, Message: res.Status}
+	}
+	envelope.Error.StatusCode = res.StatusCode
+	return &envelope.Error
+}
+
+func (e *APIError) retryable() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500 && e.StatusCode != http.StatusNotImplemented
+}
+
+type candlesPayload struct {
+	Candles []candlestick.Candle `json:"candles"`
+}
+
+type Client struct {
+	baseURL    string
+	apiKey     string
+	httpClient *http.Client
+	format     Format
+	retries    int
+	backoff    time.Duration
+}
+
+type Option func(c *Client)
+
+// WithHTTPClient replaces the default http client
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithAPIKey authenticates all requests with the given key
+func WithAPIKey(key string) Option {
+	return func(c *Client) {
+		c.apiKey = key
+	}
+}
+
+// WithFormat selects the wire format, gob is used by default
+func WithFormat(format Format) Option {
+	return func(c *Client) {
+		c.format = format
+	}
+}
+
+// WithRetries sets how often failed requests are retried, the wait time doubles
+// after every attempt starting at backoff
+func WithRetries(retries int, backoff time.Duration) Option {
+	return func(c *Client) {
+		c.retries = retries
+		c.backoff = backoff
+	}
+}
+
+func New(baseURL string, options ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+		format:     FormatGob,
+		retries:    3,
+		backoff:    500 * time.Millisecond,
+	}
+	for _, option := range options {
+		option(c)
+	}
+	return c
+}
+
+// Historical returns one block of candles starting at from
+func (c *Client) Historical(ctx context.Context, symbol string, from int64, interval int64) ([]candlestick.Candle, error) {
+	query := url.Values{}
+	query.Set("from", strconv.FormatInt(from, 10))
+	query.Set("interval", strconv.FormatInt(interval, 10))
+	payload := new(candlesPayload)
+	if err := c.get(ctx, "/market/"+url.PathEscape(symbol)+"/historical", query, payload); err != nil {
+		return nil, err
+	}
+	return payload.Candles, nil
+}
+
+// Latest returns the most recent candles starting at from
+func (c *Client) Latest(ctx context.Context, symbol string, from int64) ([]candlestick.Candle, error) {
+	query := url.Values{}
+	query.Set("from", strconv.FormatInt(from, 10))
+	payload := new(candlesPayload)
+	if err := c.get(ctx, "/market/"+url.PathEscape(symbol)+"/latest", query, payload); err != nil {
+		return nil, err
+	}
+	return payload.Candles, nil
+}
+
+// ExchangeInfo returns all exchanges and symbols known to the service
+func (c *Client) ExchangeInfo(ctx context.Context) (*candlestick.ExchangeList, error) {
+	info := new(candlestick.ExchangeList)
+	if err := c.get(ctx, "/market/info", nil, info); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// Range returns all candles in [from, to), fetching as many blocks as needed
+func (c *Client) Range(ctx context.Context, symbol string, from int64, to int64, interval int64) ([]candlestick.Candle, error) {
+	result := make([]candlestick.Candle, 0)
+	it := c.Iterate(ctx, symbol, from, to, interval)
+	for it.Next() {
+		result = append(result, it.Block()...)
+	}
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (c *Client) get(ctx context.Context, path string, query url.Values, target interface{}) error {
+	endpoint := c.baseURL + path
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+
+	wait := c.backoff
+	var err error
+	for attempt := 0; attempt <= c.retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(wait):
+			}
+			wait *= 2
+		}
+		err = c.do(ctx, endpoint, target)
+		if err == nil {
+			return nil
+		}
+		if apiErr, ok := err.(*APIError); ok {
+			if !apiErr.retryable() {
+				return err
+			}
+			if hint := time.Duration(apiErr.RetryAfter) * time.Second; hint > wait {
+				wait = hint
+			}
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+	return err
+}
+
+func (c *Client) do(ctx context.Context, endpoint string, target interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	if c.format == FormatGob {
+		req.Header.Set("Accept", "application/octet-stream")
+	} else {
+		req.Header.Set("Accept", "application/json")
+	}
+	if c.apiKey != "" {
+		req.Header.Set("X-API-Key", c.apiKey)
+	}
+
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return decodeError(res)
+	}
+
+	if c.format == FormatGob {
+		return gob.NewDecoder(res.Body).Decode(target)
+	}
+	return json.NewDecoder(res.Body).Decode(target)
+}
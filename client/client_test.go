@@ -0,0 +1,235 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"github.com/godoji/candlestick"
+	"marlin/internal/config"
+	"marlin/internal/upstream"
+	"marlin/internal/web"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// marlin serving the recorded fixtures of the example scenario
+var server *httptest.Server
+
+// start of a recorded Binance block, the scenario has a gap from 1700000000 to 1700003600
+const blockStart = int64(1699980000)
+
+func TestMain(m *testing.M) {
+	os.Exit(run(m))
+}
+
+func run(m *testing.M) int {
+	root, err := filepath.Abs("..")
+	if err != nil {
+		panic(err)
+	}
+
+	// the service keeps its data in the working directory, only the symbols of the
+	// recorded fixtures are listed
+	dir, err := os.MkdirTemp("", "marlin-client")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir)
+	if err = os.Mkdir(filepath.Join(dir, "assets"), 0755); err != nil {
+		panic(err)
+	}
+	lists := map[string]string{"binance": "BTC\n", "unicorn": "AAPL\n", "coinbase": "BTC\nETH\n"}
+	for name, symbols := range lists {
+		for _, suffix := range []string{"", ".test"} {
+			if err = os.WriteFile(filepath.Join(dir, "assets", name+suffix+".txt"), []byte(symbols), 0644); err != nil {
+				panic(err)
+			}
+		}
+	}
+	if err = os.Chdir(dir); err != nil {
+		panic(err)
+	}
+
+	config.LoadConfig(flag.NewFlagSet("test", flag.ContinueOnError), []string{
+		"-upstream", "replay",
+		"-fixtures", filepath.Join(root, "testdata", "fixtures"),
+		"-log-level", "error",
+	})
+	if err = upstream.Setup(); err != nil {
+		panic(err)
+	}
+
+	server = httptest.NewServer(web.Handler())
+	defer server.Close()
+	return m.Run()
+}
+
+var formats = []struct {
+	name   string
+	format Format
+}{
+	{"gob", FormatGob},
+	{"json", FormatJSON},
+}
+
+func TestExchangeInfo(t *testing.T) {
+	for _, f := range formats {
+		t.Run(f.name, func(t *testing.T) {
+			info, err := New(server.URL, WithFormat(f.format)).ExchangeInfo(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			symbols := make(map[string]*candlestick.AssetInfo)
+			for _, exchange := range info.Exchanges {
+				for id, asset := range exchange.Symbols {
+					symbols[id] = asset
+				}
+			}
+			for _, id := range []string{"BINANCE:SPOT:BTCUSDT", "BINANCE:PERP:BTCUSDT", "UNICORN:US:AAPL", "COINBASE:SPOT:BTC-USD"} {
+				if _, ok := symbols[id]; !ok {
+					t.Errorf("symbol %s is missing", id)
+				}
+			}
+			if asset, ok := symbols["BINANCE:SPOT:BTCUSDT"]; ok && asset.OnBoardDate != 1502942400 {
+				t.Errorf("BINANCE:SPOT:BTCUSDT listed at %d, want 1502942400", asset.OnBoardDate)
+			}
+		})
+	}
+}
+
+func TestHistorical(t *testing.T) {
+	for _, f := range formats {
+		t.Run(f.name, func(t *testing.T) {
+			candles, err := New(server.URL, WithFormat(f.format)).Historical(context.Background(), "BINANCE:SPOT:BTCUSDT", blockStart, candlestick.Interval1m)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(candles) != 1000 {
+				t.Fatalf("got %d candles, want 1000", len(candles))
+			}
+			for i, c := range candles {
+				inGap := c.Time >= 1700000000 && c.Time < 1700003600
+				if c.Missing != inGap {
+					t.Fatalf("candle %d at %d missing is %v, want %v", i, c.Time, c.Missing, inGap)
+				}
+			}
+		})
+	}
+}
+
+func TestRange(t *testing.T) {
+	tests := []struct {
+		name     string
+		symbol   string
+		from     int64
+		to       int64
+		interval int64
+		count    int
+		missing  []int64
+	}{
+		{
+			name:     "across blocks",
+			symbol:   "BINANCE:SPOT:BTCUSDT",
+			from:     blockStart,
+			to:       blockStart + 1200*60,
+			interval: candlestick.Interval1m,
+			count:    1200,
+			missing:  []int64{1700000040, 1700003580},
+		},
+		{
+			name:     "into gap",
+			symbol:   "BINANCE:SPOT:BTCUSDT",
+			from:     blockStart,
+			to:       1700000100,
+			interval: candlestick.Interval1m,
+			count:    335,
+			missing:  []int64{1700000040},
+		},
+		{
+			name:     "unpaged",
+			symbol:   "UNICORN:US:AAPL",
+			from:     1583020800, // 2020-03-01
+			to:       1585699200, // 2020-04-01
+			interval: candlestick.Interval1d,
+			count:    31,
+			missing:  []int64{1583020800, 1584316800}, // a sunday and the recorded outage
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			candles, err := New(server.URL).Range(context.Background(), test.symbol, test.from, test.to, test.interval)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(candles) != test.count {
+				t.Fatalf("got %d candles, want %d", len(candles), test.count)
+			}
+			for i, c := range candles {
+				if want := test.from + int64(i)*test.interval; c.Time != want {
+					t.Fatalf("candle %d at %d, want %d", i, c.Time, want)
+				}
+			}
+			byTime := make(map[int64]candlestick.Candle)
+			for _, c := range candles {
+				byTime[c.Time] = c
+			}
+			for _, at := range test.missing {
+				if !byTime[at].Missing {
+					t.Errorf("candle at %d is not missing", at)
+				}
+			}
+		})
+	}
+}
+
+func TestAPIError(t *testing.T) {
+	_, err := New(server.URL, WithRetries(0, 0)).Historical(context.Background(), "NOPE:SPOT:BTCUSDT", blockStart, candlestick.Interval1m)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("got %v, want an APIError", err)
+	}
+	if apiErr.StatusCode != http.StatusBadRequest || apiErr.Code != "INVALID_SOURCE" {
+		t.Errorf("got %d %s, want 400 INVALID_SOURCE", apiErr.StatusCode, apiErr.Code)
+	}
+}
+
+func TestIterateStopsAtNow(t *testing.T) {
+
+	// blocks past now only hold missing candles
+	requests := int32(0)
+	stub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		from, _ := strconv.ParseInt(r.URL.Query().Get("from"), 10, 64)
+		from -= from % (1000 * candlestick.Interval1m)
+		now := time.Now().Unix()
+		payload := candlesPayload{Candles: make([]candlestick.Candle, 1000)}
+		for i := range payload.Candles {
+			t := from + int64(i)*candlestick.Interval1m
+			payload.Candles[i] = candlestick.Candle{Time: t, Open: 1, High: 1, Low: 1, Close: 1, Missing: t >= now}
+		}
+		_ = json.NewEncoder(w).Encode(payload)
+	}))
+	defer stub.Close()
+
+	now := time.Now().Unix()
+	candles, err := New(stub.URL, WithFormat(FormatJSON)).Range(context.Background(), "BINANCE:SPOT:BTCUSDT", now-now%60-10*60, now+365*24*3600, candlestick.Interval1m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&requests); n > 2 {
+		t.Errorf("made %d requests for a range ending in the future, want at most 2", n)
+	}
+	for _, c := range candles {
+		if c.Time > time.Now().Unix() {
+			t.Fatalf("got candle at %d after now", c.Time)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package client
+
+import (
+	"context"
+	"github.com/godoji/candlestick"
+	"time"
+)
+
+// RangeIterator walks over a range of candles one block at a time, blocks are
+// only requested when Next is called
+type RangeIterator struct {
+	client   *Client
+	ctx      context.Context
+	symbol   string
+	cursor   int64
+	to       int64
+	interval int64
+	block    []candlestick.Candle
+	err      error
+	done     bool
+}
+
+// Iterate returns an iterator over all candles in [from, to)
+func (c *Client) Iterate(ctx context.Context, symbol string, from int64, to int64, interval int64) *RangeIterator {
+	return &RangeIterator{
+		client:   c,
+		ctx:      ctx,
+		symbol:   symbol,
+		cursor:   from,
+		to:       to,
+		interval: interval,
+	}
+}
+
+// end returns the end of the range, candles after now do not exist yet and would
+// only come back as missing blocks
+func (it *RangeIterator) end() int64 {
+	if now := time.Now().Unix(); now < it.to {
+		return now
+	}
+	return it.to
+}
+
+// Next fetches the next block, it returns false once the range is exhausted or
+// an error occurred
+func (it *RangeIterator) Next() bool {
+	for !it.done && it.cursor < it.end() {
+		to := it.end()
+		candles, err := it.client.Historical(it.ctx, it.symbol, it.cursor, it.interval)
+		if err != nil {
+			it.err = err
+			it.done = true
+			return false
+		}
+
+		it.block = make([]candlestick.Candle, 0, len(candles))
+		next := it.cursor
+		for _, c := range candles {
+			if c.Time >= it.cursor && c.Time < to {
+				it.block = append(it.block, c)
+			}
+			if c.Time+it.interval > next {
+				next = c.Time + it.interval
+			}
+		}
+
+		// sources without paging return everything at once
+		if next <= it.cursor {
+			it.done = true
+		}
+		it.cursor = next
+
+		if len(it.block) > 0 {
+			return true
+		}
+	}
+	it.done = true
+	return false
+}
+
+// Block returns the candles fetched by the last call to Next
+func (it *RangeIterator) Block() []candlestick.Candle {
+	return it.block
+}
+
+// Err returns the error which stopped the iteration, if any
+func (it *RangeIterator) Err() error {
+	return it.err
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"marlin/internal/backfill"
+	"marlin/internal/datalock"
+	"marlin/internal/gaps"
+	"marlin/internal/logger"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+)
+
+func splitList(s string) []string {
+	result := make([]string, 0)
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+func runBackfill(args []string) int {
+	fs := flag.NewFlagSet("backfill", flag.ExitOnError)
+	symbols := fs.String("symbols", "", "comma separated symbols to download")
+	exchanges := fs.String("exchanges", "", "comma separated BROKER:EXCHANGE pairs, all of their symbols are downloaded")
+	from := fs.Int64("from", 0, "unix timestamp to start from, assets start no earlier than their on board date")
+	to := fs.Int64("to", 0, "unix timestamp to stop at, defaults to now")
+	interval := fs.Int64("interval", 60, "candle interval in seconds")
+	resume := fs.Bool("resume", false, "only resume unfinished jobs")
+	loadConfig(fs, args)
+
+	// a running server owns the jobs, submit them through its api instead
+	release, err := datalock.Acquire()
+	if err != nil {
+		logger.Error("could not lock the data directory, submit the job to the running server with POST /jobs", logger.F("error", err))
+		return 1
+	}
+	defer release()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if !*resume {
+		spec := backfill.Spec{
+			Symbols:   splitList(*symbols),
+			Exchanges: splitList(*exchanges),
+			From:      *from,
+			To:        *to,
+			Interval:  *interval,
+		}
+		job, ex := backfill.Submit(spec)
+		if ex != nil {
+			logger.Error("invalid backfill job", logger.F("error", ex))
+			return 2
+		}
+		fmt.Println(job.Id)
+	}
+
+	defer gaps.Flush()
+
+	// runs every pending job, including those left over by a server
+	backfill.RunPending(ctx)
+
+	failed := false
+	for _, job := range backfill.List() {
+		if job.Status == backfill.StatusFailed {
+			failed = true
+		}
+	}
+	if ctx.Err() != nil || failed {
+		return 1
+	}
+	return 0
+}
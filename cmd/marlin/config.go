@@ -0,0 +1,17 @@
+package main
+
+import (
+	"flag"
+	"marlin/internal/config"
+	"marlin/internal/logger"
+	"marlin/internal/upstream"
+)
+
+// loadConfig parses the service flags along with the command's own flags on fs and
+// connects the brokers accordingly
+func loadConfig(fs *flag.FlagSet, args []string) {
+	config.LoadConfig(fs, args)
+	if err := upstream.Setup(); err != nil {
+		logger.Fatal("invalid upstream configuration", logger.F("error", err))
+	}
+}
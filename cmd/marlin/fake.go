@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"marlin/internal/fakeupstream"
+	"marlin/internal/logger"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+func runFakeUpstream(args []string) int {
+	fs := flag.NewFlagSet("fake-upstream", flag.ExitOnError)
+	scenarioPath := fs.String("scenario", "./testdata/scenarios/example.json", "scenario file driving the fake upstream")
+	addr := fs.String("addr", "127.0.0.1:9710", "address to listen on")
+	_ = fs.Parse(args)
+
+	scenario, err := fakeupstream.LoadScenario(*scenarioPath)
+	if err != nil {
+		logger.Error("could not load scenario", logger.F("error", err))
+		return 1
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	server := &http.Server{Addr: *addr, Handler: fakeupstream.NewServer(scenario)}
+	go func() {
+		<-ctx.Done()
+		_ = server.Shutdown(context.Background())
+	}()
+
+	base := "http://" + *addr
+	logger.Info("fake upstream listening", logger.F("addr", *addr), logger.F("scenario", *scenarioPath))
+	fmt.Printf("-binance-spot-url %s -binance-futures-url %s -unicorn-url %s/api -coinbase-url %s\n", base, base, base, base)
+
+	if err = server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		logger.Error("fake upstream stopped", logger.F("error", err))
+		return 1
+	}
+	return 0
+}
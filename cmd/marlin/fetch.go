@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/godoji/candlestick"
+	"marlin/internal/arbiter"
+	"marlin/internal/config"
+	"marlin/internal/datalock"
+	"marlin/internal/gaps"
+	"marlin/internal/logger"
+	"marlin/internal/requests"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+func runFetch(args []string) int {
+	var symbol string
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		symbol, args = args[0], args[1:]
+	}
+
+	fs := flag.NewFlagSet("fetch", flag.ExitOnError)
+	from := fs.Int64("from", 0, "unix timestamp of the first candle")
+	to := fs.Int64("to", 0, "unix timestamp after the last candle, defaults to now")
+	interval := fs.Int64("interval", candlestick.Interval1m, "candle interval in seconds")
+	format := fs.String("format", "csv", "output format: csv or parquet")
+	output := fs.String("o", "", "output file, stdout when empty")
+	dropMissing := fs.Bool("drop-missing", false, "leave out candles filled in for gaps")
+	loadConfig(fs, args)
+
+	if symbol == "" && fs.NArg() > 0 {
+		symbol = fs.Arg(0)
+	}
+	target, ok := candlestick.ParseSymbol(symbol)
+	if !ok {
+		fmt.Fprintln(os.Stderr, "usage: marlin fetch <uuid> -from <ts> [-to <ts>] [-interval 60] [-format csv] [-o file]")
+		return 2
+	}
+	if target.Broker == config.SourceComposite {
+		fmt.Fprintln(os.Stderr, "composite candles can not be fetched into a table, it has no column for their sources")
+		return 2
+	}
+	if *to == 0 {
+		*to = time.Now().UTC().Unix()
+	}
+
+	// gaps found while fetching are written to ./data/gaps.json
+	release, err := datalock.Acquire()
+	if err != nil {
+		logger.Error("could not lock the data directory, fetch through the running server instead", logger.F("error", err))
+		return 1
+	}
+	defer release()
+
+	out := os.Stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			logger.Error("could not create output file", logger.F("path", *output), logger.F("error", err))
+			return 1
+		}
+		defer file.Close()
+		out = file
+	}
+
+	table, err := requests.NewCandleWriter(out, *format)
+	if err != nil {
+		logger.Error("could not write candles", logger.F("error", err))
+		return 1
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	defer gaps.Flush()
+
+	count := 0
+	ex := arbiter.WalkHistorical(ctx, target, *from, *to, *interval, func(candles []candlestick.Candle) bool {
+		if *dropMissing {
+			candles = arbiter.DropMissing(candles)
+		}
+		if err = table.Write(candles); err != nil {
+			return false
+		}
+		count += len(candles)
+		return true
+	})
+	if ex == nil && err == nil {
+		err = table.Close()
+	}
+	if ex != nil || err != nil {
+		logger.Error("fetch failed", logger.F("symbol", target.ToString()), logger.F("error", ex), logger.F("write_error", err))
+		return 1
+	}
+
+	logger.Info("fetch complete", logger.F("symbol", target.ToString()), logger.F("candles", count))
+	return 0
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"marlin/internal/arbiter"
+	"marlin/internal/config"
+	"marlin/internal/datalock"
+	"marlin/internal/logger"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+func runInfo(args []string) int {
+	action := "show"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		action, args = args[0], args[1:]
+	}
+	loadConfig(flag.NewFlagSet("info "+action, flag.ExitOnError), args)
+
+	switch action {
+	case "show":
+	case "refresh":
+		if config.ServiceConfig().IsOffline() {
+			logger.Error("cannot refresh exchange info in offline mode")
+			return 1
+		}
+		// the refreshed info is written to ./data/exchange.json
+		release, err := datalock.Acquire()
+		if err != nil {
+			logger.Error("could not lock the data directory, the running server refreshes exchange info itself", logger.F("error", err))
+			return 1
+		}
+		defer release()
+		if err := arbiter.RefreshExchangeInfo(); err != nil {
+			return 1
+		}
+	default:
+		fmt.Fprintln(os.Stderr, "usage: marlin info show|refresh [flags]")
+		return 2
+	}
+
+	info := arbiter.ExchangeInfo()
+	sort.Slice(info.Exchanges, func(i, j int) bool {
+		return info.Exchanges[i].BrokerId+info.Exchanges[i].ExchangeId < info.Exchanges[j].BrokerId+info.Exchanges[j].ExchangeId
+	})
+	for _, exchange := range info.Exchanges {
+		fmt.Printf("%s:%s\t%d symbols\tupdated %s\n",
+			exchange.BrokerId,
+			exchange.ExchangeId,
+			len(exchange.Symbols),
+			time.Unix(exchange.LastUpdate, 0).UTC().Format(time.RFC3339),
+		)
+	}
+	return 0
+}
@@ -1,15 +1,50 @@
 package main
 
 import (
-	"log"
-	"marlin/internal/arbiter"
-	"marlin/internal/config"
-	"marlin/internal/web"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
 )
 
+type command struct {
+	usage string
+	run   func(args []string) int
+}
+
+var commands = map[string]command{
+	"serve":         {"run the REST and gRPC API", runServe},
+	"info":          {"show or refresh the cached exchange info: info show|refresh", runInfo},
+	"fetch":         {"download candles to a file: fetch <uuid> -from -to -interval -format csv", runFetch},
+	"backfill":      {"download history into the local candle store", runBackfill},
+	"verify-cache":  {"check the cache files and candle store, -repair fixes what it can", runVerifyCache},
+	"symbols":       {"compare the whitelist with upstream markets: symbols diff", runSymbols},
+	"fake-upstream": {"serve fake Binance and EOD APIs driven by a scenario file", runFakeUpstream},
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: marlin <command> [flags]")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-13s %s\n", name, commands[name].usage)
+	}
+}
+
 func main() {
-	log.Println("|- Marlin - Market Linker -|")
-	config.LoadConfig()
-	arbiter.ExchangeInfo() // preload exchange info
-	web.Start()
+	// without a command marlin serves, keeping plain flag invocations working
+	name, args := "serve", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+
+	cmd, ok := commands[name]
+	if !ok {
+		usage()
+		os.Exit(2)
+	}
+	os.Exit(cmd.run(args))
 }
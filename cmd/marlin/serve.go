@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"marlin/internal/arbiter"
+	"marlin/internal/auth"
+	"marlin/internal/backfill"
+	"marlin/internal/config"
+	"marlin/internal/datalock"
+	"marlin/internal/logger"
+	"marlin/internal/rpc"
+	"marlin/internal/tracing"
+	"marlin/internal/web"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+func runServe(args []string) int {
+	loadConfig(flag.NewFlagSet("serve", flag.ExitOnError), args)
+	logger.Info("|- Marlin - Market Linker -|")
+
+	// backfills from the command line would race the server on jobs and the store
+	release, err := datalock.Acquire()
+	if err != nil {
+		logger.Fatal("could not lock the data directory", logger.F("error", err))
+	}
+	defer release()
+
+	auth.LoadKeys(config.ServiceConfig().ApiKeysPath())
+
+	flushTraces, err := tracing.Setup(config.ServiceConfig().OtelEndpoint())
+	if err != nil {
+		logger.Fatal("could not create trace exporter", logger.F("error", err))
+	} else if endpoint := config.ServiceConfig().OtelEndpoint(); endpoint != "" {
+		logger.Info("exporting traces", logger.F("endpoint", endpoint))
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	arbiter.ExchangeInfo() // preload exchange info
+	arbiter.StartGapChecks()
+	arbiter.StartDepthRecorder()
+
+	var servers sync.WaitGroup
+	servers.Add(2)
+	go func() {
+		defer servers.Done()
+		rpc.Start(ctx)
+	}()
+	go func() {
+		defer servers.Done()
+		backfill.Start(ctx)
+	}()
+	web.Start(ctx)
+	servers.Wait()
+
+	// wait for background refreshes so cache files are never cut short
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), config.ServiceConfig().ShutdownTimeout())
+	defer cancel()
+	arbiter.Shutdown(shutdownCtx)
+	flushTraces(shutdownCtx)
+
+	logger.Info("shutdown complete")
+	return 0
+}
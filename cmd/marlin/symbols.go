@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"marlin/internal/binance"
+	"marlin/internal/config"
+	"marlin/internal/logger"
+	"os"
+	"sort"
+)
+
+// runSymbols lists whitelisted assets without an upstream market (-) and, with -all,
+// upstream markets which are not whitelisted (+)
+func runSymbols(args []string) int {
+	if len(args) == 0 || args[0] != "diff" {
+		fmt.Fprintln(os.Stderr, "usage: marlin symbols diff [-all] [flags]")
+		return 2
+	}
+
+	fs := flag.NewFlagSet("symbols diff", flag.ExitOnError)
+	all := fs.Bool("all", false, "also list upstream assets which are not whitelisted")
+	loadConfig(fs, args[1:])
+
+	whitelist := config.SymbolList(config.SourceBinance)
+	differs := false
+	for _, exchange := range []string{"SPOT", "PERP"} {
+		tradable, err := binance.TradableAssets(context.Background(), exchange)
+		if err != nil {
+			logger.Error("could not list upstream markets", logger.F("exchange", exchange), logger.F("error", err))
+			return 1
+		}
+
+		lines := make([]string, 0)
+		for asset := range whitelist {
+			if !tradable[asset] {
+				lines = append(lines, "- "+asset)
+			}
+		}
+		if *all {
+			for asset := range tradable {
+				if !whitelist[asset] {
+					lines = append(lines, "+ "+asset)
+				}
+			}
+		}
+		sort.Slice(lines, func(i, j int) bool { return lines[i][2:] < lines[j][2:] })
+
+		fmt.Printf("%s:%s\n", config.SourceBinance, exchange)
+		for _, line := range lines {
+			fmt.Println(line)
+			differs = differs || line[0] == '-'
+		}
+	}
+
+	if differs {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"marlin/internal/datalock"
+	"marlin/internal/store"
+	"os"
+)
+
+// cache files which only need to decode
+var cacheFiles = []string{"./data/exchange.json", "./data/gaps.json", "./data/jobs.json"}
+
+func runVerifyCache(args []string) int {
+	fs := flag.NewFlagSet("verify-cache", flag.ExitOnError)
+	repair := fs.Bool("repair", false, "remove corrupt chunks and rewrite chunks with misplaced candles")
+	loadConfig(fs, args)
+
+	// repairs rewrite chunks a running server may be writing as well
+	if *repair {
+		release, err := datalock.Acquire()
+		if err != nil {
+			fmt.Printf("could not lock the data directory: %v\n", err)
+			return 1
+		}
+		defer release()
+	}
+
+	broken := false
+	for _, path := range cacheFiles {
+		file, err := os.Open(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err == nil {
+			var v interface{}
+			err = json.NewDecoder(file).Decode(&v)
+			_ = file.Close()
+		}
+		if err != nil {
+			broken = true
+			fmt.Printf("%s: %v\n", path, err)
+		}
+	}
+
+	chunks, problems, err := store.Verify(*repair)
+	if err != nil {
+		fmt.Printf("could not walk candle store: %v\n", err)
+		return 1
+	}
+	for _, p := range problems {
+		status := ""
+		switch {
+		case p.Repaired:
+			status = " (repaired)"
+		case p.Warning:
+			status = " (warning)"
+		default:
+			broken = true
+		}
+		fmt.Printf("%s: %s%s\n", p.Path, p.Message, status)
+	}
+	fmt.Printf("%d chunks checked, %d problems\n", chunks, len(problems))
+
+	if broken {
+		return 1
+	}
+	return 0
+}
@@ -1,13 +1,20 @@
 package arbiter
 
 import (
+	"context"
 	"encoding/json"
 	"github.com/godoji/candlestick"
-	"log"
+	"io"
+	"marlin/internal/atomicfile"
 	"marlin/internal/binance"
+	"marlin/internal/coinbase"
 	"marlin/internal/config"
+	"marlin/internal/gaps"
+	"marlin/internal/logger"
 	"marlin/internal/throw"
+	"marlin/internal/tracing"
 	"marlin/internal/unicorn"
+	"math"
 	"os"
 	"sync"
 	"time"
@@ -17,13 +24,49 @@ var exchangeInfoCache *candlestick.ExchangeList = nil
 var exchangeInfoLock = sync.Mutex{}
 var exchangeIsFetching = false
 
-func FetchHistorical(target candlestick.AssetIdentifier, from int64, interval int64) ([]candlestick.Candle, throw.Exception) {
+// stale exchange info is refreshed at most this often, so an outage does not turn
+// every request into another refresh
+const refreshBackoff = 5 * time.Minute
+
+var lastRefreshAttempt time.Time
+
+// background work is bound to this context so it can be cancelled on shutdown
+var backgroundCtx, cancelBackground = context.WithCancel(context.Background())
+var backgroundTasks sync.WaitGroup
+
+// Shutdown cancels background refreshes and waits until they have stopped or ctx expires
+func Shutdown(ctx context.Context) {
+	cancelBackground()
+	defer gaps.Flush()
+	done := make(chan struct{})
+	go func() {
+		backgroundTasks.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		logger.Warn("background tasks did not stop in time")
+	}
+}
+
+func FetchHistorical(ctx context.Context, target candlestick.AssetIdentifier, from int64, interval int64) ([]candlestick.Candle, throw.Exception) {
+	// blocks start on the interval grid like the brokers' candles, otherwise the
+	// first candle would be filled in as a gap
+	if interval > 0 {
+		if rem := from % interval; rem != 0 {
+			from += interval - rem
+		}
+	}
 	tsFrom := time.Unix(from, 0).UTC()
 	switch target.Broker {
 	case config.SourceUnicorn:
 		switch interval {
 		case candlestick.Interval1d:
-			return unicorn.FetchHistorical(target)
+			if config.ServiceConfig().IsOffline() {
+				return storedHistory(target, interval)
+			}
+			return unicorn.FetchHistorical(ctx, target)
 		default:
 			return nil, throw.ErrIntervalNotSupported
 		}
@@ -33,44 +76,142 @@ func FetchHistorical(target candlestick.AssetIdentifier, from int64, interval in
 		}
 		switch interval {
 		case candlestick.Interval1m:
-			return binance.FetchCandles(tsFrom, target)
+			if config.ServiceConfig().IsOffline() {
+				return storedBlock(target, from, interval, binance.BlockSize)
+			}
+			return binance.FetchCandles(ctx, tsFrom, target, listedAt(target))
+		default:
+			return nil, throw.ErrIntervalNotSupported
+		}
+	case config.SourceCoinbase:
+		if from == 0 {
+			return nil, throw.ErrInvalidFromParameter
+		}
+		switch interval {
+		case candlestick.Interval1m:
+			if config.ServiceConfig().IsOffline() {
+				return storedBlock(target, from, interval, coinbase.BlockSize)
+			}
+			return coinbase.FetchCandles(ctx, tsFrom, target, listedAt(target))
 		default:
 			return nil, throw.ErrIntervalNotSupported
 		}
+	case config.SourceSynth:
+		return fetchSynthetic(ctx, target, func(leg candlestick.AssetIdentifier) ([]candlestick.Candle, throw.Exception) {
+			return FetchHistorical(ctx, leg, from, interval)
+		})
+	case config.SourceComposite:
+		candles, _, ex := FetchCompositeHistorical(ctx, target, from, interval)
+		return candles, ex
 	default:
 		return nil, throw.ErrInvalidSource
 	}
 }
 
-func FetchLatest(target candlestick.AssetIdentifier, from int64) ([]candlestick.Candle, throw.Exception) {
+func FetchLatest(ctx context.Context, target candlestick.AssetIdentifier, from int64) ([]candlestick.Candle, throw.Exception) {
 	switch target.Broker {
 	case config.SourceUnicorn:
 		return nil, throw.ErrSourceNotSupported
 	case config.SourceBinance:
-		return binance.FetchLatest(from, target)
+		if config.ServiceConfig().IsOffline() {
+			return storedLatest(target, from, candlestick.Interval1m, binance.LatestSize)
+		}
+		return binance.FetchLatest(ctx, from, target)
+	case config.SourceCoinbase:
+		if config.ServiceConfig().IsOffline() {
+			return storedLatest(target, from, candlestick.Interval1m, coinbase.LatestSize)
+		}
+		return coinbase.FetchLatest(ctx, from, target)
+	case config.SourceSynth:
+		return fetchSynthetic(ctx, target, func(leg candlestick.AssetIdentifier) ([]candlestick.Candle, throw.Exception) {
+			return FetchLatest(ctx, leg, from)
+		})
+	case config.SourceComposite:
+		candles, _, ex := FetchCompositeLatest(ctx, target, from)
+		return candles, ex
 	default:
 		return nil, throw.ErrInvalidSource
 	}
 }
 
-func refreshExchangeInfo() {
+// infoFetcher fetches the exchange info of one exchange of a broker
+type infoFetcher struct {
+	broker   string
+	exchange string
+	fetch    func(ctx context.Context) (*candlestick.ExchangeInfo, error)
+}
+
+var infoFetchers = []infoFetcher{
+	{config.SourceUnicorn, "US", unicorn.GetInfo},
+	{config.SourceBinance, "SPOT", binance.GetSpotInfo},
+	{config.SourceBinance, "PERP", binance.GetFuturesInfo},
+	{config.SourceCoinbase, "SPOT", coinbase.GetInfo},
+}
+
+// RefreshExchangeInfo fetches exchange info from every broker and replaces the cache,
+// an exchange which fails keeps its previous exchange info so one broker going down
+// does not hold back the others. The first error is returned once every exchange
+// was tried.
+func RefreshExchangeInfo() error {
+	// refreshes outlive the request which triggered them
+	ctx, span := tracing.Start(backgroundCtx, "arbiter.RefreshExchangeInfo")
+	defer span.End()
+	start := time.Now()
+
+	exchangeInfoLock.Lock()
+	if exchangeInfoCache == nil {
+		loadInfoFromDisk()
+	}
+	previous := exchangeInfoCache
+	exchangeInfoLock.Unlock()
+
 	result := &candlestick.ExchangeList{
 		Exchanges: make([]*candlestick.ExchangeInfo, 0),
 		BrokerInfo: map[string]*candlestick.BrokerInfo{
-			"BINANCE": {Name: "Binance"},
-			"UNICORN": {Name: "Unicorn"},
+			"BINANCE":  {Name: "Binance"},
+			"UNICORN":  {Name: "Unicorn"},
+			"COINBASE": {Name: "Coinbase"},
 		},
 	}
 
-	result.Exchanges = append(result.Exchanges, unicorn.GetInfo())
-	result.Exchanges = append(result.Exchanges, binance.GetSpotInfo())
-	result.Exchanges = append(result.Exchanges, binance.GetFuturesInfo())
+	var firstErr error
+	for _, fetcher := range infoFetchers {
+		info, err := fetcher.fetch(ctx)
+		if err == nil {
+			result.Exchanges = append(result.Exchanges, info)
+			continue
+		}
+		logger.Error("exchange info refresh failed",
+			logger.F("broker", fetcher.broker),
+			logger.F("exchange", fetcher.exchange),
+			logger.F("error", err),
+		)
+		if firstErr == nil {
+			firstErr = err
+		}
+		// keep serving the previous exchange info of this exchange
+		if previous != nil {
+			for _, exchange := range previous.Exchanges {
+				if exchange.BrokerId == fetcher.broker && exchange.ExchangeId == fetcher.exchange {
+					result.Exchanges = append(result.Exchanges, exchange)
+				}
+			}
+		}
+	}
 
 	exchangeInfoLock.Lock()
 	defer exchangeInfoLock.Unlock()
+	exchangeIsFetching = false
+	lastRefreshAttempt = time.Now()
+
+	if len(result.Exchanges) == 0 {
+		return firstErr
+	}
+
+	logger.Info("exchange info refreshed", logger.F("duration", time.Since(start).String()))
 	exchangeInfoCache = result
 	writeInfoToDisk()
-	exchangeIsFetching = false
+	return firstErr
 }
 
 func ExchangeInfo() *candlestick.ExchangeList {
@@ -84,7 +225,7 @@ func ExchangeInfo() *candlestick.ExchangeList {
 
 	if config.ServiceConfig().IsOffline() {
 		if exchangeInfoCache == nil {
-			log.Fatalln("no cached exchange info found")
+			logger.Fatal("no cached exchange info found")
 		}
 
 		defer exchangeInfoLock.Unlock()
@@ -94,7 +235,8 @@ func ExchangeInfo() *candlestick.ExchangeList {
 	// Check if we have any data
 	if exchangeInfoCache != nil {
 		now := time.Now().UTC().Unix()
-		isUpToDate := true
+		// exchanges which never refreshed successfully are missing altogether
+		isUpToDate := len(exchangeInfoCache.Exchanges) >= len(infoFetchers)
 		for _, exchange := range exchangeInfoCache.Exchanges {
 			if (now - exchange.LastUpdate) > 8*60*60 {
 				isUpToDate = false
@@ -102,34 +244,49 @@ func ExchangeInfo() *candlestick.ExchangeList {
 			}
 		}
 		// Update the exchange data in the background
-		if !isUpToDate && !exchangeIsFetching {
+		if !isUpToDate && !exchangeIsFetching && time.Since(lastRefreshAttempt) >= refreshBackoff && backgroundCtx.Err() == nil {
 			exchangeIsFetching = true
-			go refreshExchangeInfo()
+			backgroundTasks.Add(1)
+			go func() {
+				defer backgroundTasks.Done()
+				_ = RefreshExchangeInfo()
+			}()
 		}
 		defer exchangeInfoLock.Unlock()
 		return exchangeInfoCache
 	}
 
-	// Fetch data synchronously
+	// Fetch data synchronously, brokers which failed are retried in the background
 	exchangeInfoLock.Unlock()
-	refreshExchangeInfo()
+	err := RefreshExchangeInfo()
 
 	// Return exchange data
 	exchangeInfoLock.Lock()
 	defer exchangeInfoLock.Unlock()
+	if exchangeInfoCache == nil {
+		logger.Fatal("could not fetch exchange info", logger.F("error", err))
+	}
 	return exchangeInfoCache
 }
 
-func writeInfoToDisk() {
-	file, err := os.Create("./data/exchange.json")
-	if err != nil {
-		log.Fatal(err)
+// listedAt returns the time of the first candle of target, or the minimum when it is
+// not known
+func listedAt(target candlestick.AssetIdentifier) int64 {
+	for _, exchange := range ExchangeInfo().Exchanges {
+		if asset, ok := exchange.Symbols[target.ToString()]; ok {
+			return asset.OnBoardDate
+		}
 	}
-	err = json.NewEncoder(file).Encode(exchangeInfoCache)
+	return math.MinInt64
+}
+
+func writeInfoToDisk() {
+	err := atomicfile.WriteFile("./data/exchange.json", func(w io.Writer) error {
+		return json.NewEncoder(w).Encode(exchangeInfoCache)
+	})
 	if err != nil {
-		log.Fatal(err)
+		logger.Error("could not write exchange info cache", logger.F("error", err))
 	}
-	_ = file.Close()
 }
 
 func loadInfoFromDisk() bool {
@@ -139,15 +296,15 @@ func loadInfoFromDisk() bool {
 	}
 	file, err := os.Open(path)
 	if err != nil {
-		log.Fatal(err)
+		logger.Fatal("could not open exchange info cache", logger.F("path", path), logger.F("error", err))
 	}
 	e := new(candlestick.ExchangeList)
 	err = json.NewDecoder(file).Decode(e)
 	if err != nil {
-		log.Fatal(err)
+		logger.Fatal("could not decode exchange info cache", logger.F("path", path), logger.F("error", err))
 	}
 	_ = file.Close()
-	log.Println("existing exchange info for binance found")
+	logger.Info("existing exchange info found", logger.F("path", path))
 	exchangeInfoCache = e
 	return true
 }
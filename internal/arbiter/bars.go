@@ -0,0 +1,190 @@
+package arbiter
+
+import (
+	"errors"
+	"github.com/godoji/candlestick"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// bar transforms
+const (
+	BarsHeikinAshi = "heikin-ashi"
+	BarsRenko      = "renko"  // a brick every size move of the close
+	BarsRange      = "range"  // a bar once high and low are size apart
+	BarsVolume     = "volume" // a bar every size base asset traded
+	BarsDollar     = "dollar" // a bar every size quote asset traded
+)
+
+type BarTransform struct {
+	Type string
+	Size float64
+}
+
+// maxBricks caps the renko bricks of a response, small sizes would otherwise build
+// bricks until the server runs out of memory
+const maxBricks = 100000
+
+var errInvalidBarTransform = errors.New("bars must be heikin-ashi, renko:size, range:size, volume:size or dollar:size")
+var errBrickSize = errors.New("renko size is too small for the price")
+var errTooManyBricks = errors.New("too many renko bricks, request a larger size")
+
+// ParseBarTransform parses the bars parameter such as heikin-ashi or renko:25
+func ParseBarTransform(s string) (BarTransform, error) {
+	parts := strings.SplitN(s, ":", 2)
+	spec := BarTransform{Type: parts[0]}
+	switch spec.Type {
+	case BarsHeikinAshi:
+		if len(parts) > 1 {
+			return spec, errInvalidBarTransform
+		}
+		return spec, nil
+	case BarsRenko, BarsRange, BarsVolume, BarsDollar:
+		if len(parts) < 2 {
+			return spec, errInvalidBarTransform
+		}
+		size, err := strconv.ParseFloat(parts[1], 64)
+		if err != nil || size <= 0 || math.IsInf(size, 0) {
+			return spec, errInvalidBarTransform
+		}
+		spec.Size = size
+		return spec, nil
+	default:
+		return spec, errInvalidBarTransform
+	}
+}
+
+// TransformBars derives bars from time based candles. Heikin-Ashi bars keep the time
+// of their candle, missing candles stay missing. The other bars skip missing candles,
+// take the time of the candle they start at and do not carry over between calls.
+func TransformBars(candles []candlestick.Candle, spec BarTransform) ([]candlestick.Candle, error) {
+	switch spec.Type {
+	case BarsHeikinAshi:
+		return heikinAshi(candles), nil
+	case BarsRenko:
+		return renko(candles, spec.Size)
+	case BarsRange:
+		return accumulate(candles, func(bar *candlestick.Candle, _ candlestick.Candle) bool {
+			return bar.High-bar.Low >= spec.Size
+		}), nil
+	case BarsVolume:
+		return accumulate(candles, func(bar *candlestick.Candle, _ candlestick.Candle) bool {
+			return bar.Volume >= spec.Size
+		}), nil
+	case BarsDollar:
+		filled := 0.0
+		return accumulate(candles, func(bar *candlestick.Candle, c candlestick.Candle) bool {
+			// quote volume of a candle is estimated from its typical price
+			filled += c.Volume * (c.High + c.Low + c.Close) / 3
+			if filled < spec.Size {
+				return false
+			}
+			filled = 0
+			return true
+		}), nil
+	default:
+		return candles, nil
+	}
+}
+
+func heikinAshi(candles []candlestick.Candle) []candlestick.Candle {
+	result := make([]candlestick.Candle, len(candles))
+	var previous *candlestick.Candle
+	for i, c := range candles {
+		if c.Missing {
+			result[i] = c
+			continue
+		}
+		bar := c
+		bar.Close = (c.Open + c.High + c.Low + c.Close) / 4
+		if previous == nil {
+			bar.Open = (c.Open + c.Close) / 2
+		} else {
+			bar.Open = (previous.Open + previous.Close) / 2
+		}
+		bar.High = math.Max(c.High, math.Max(bar.Open, bar.Close))
+		bar.Low = math.Min(c.Low, math.Min(bar.Open, bar.Close))
+		result[i] = bar
+		previous = &result[i]
+	}
+	return result
+}
+
+// accumulate merges consecutive candles into a bar until full reports the bar is done,
+// the last bar may be unfinished
+func accumulate(candles []candlestick.Candle, full func(bar *candlestick.Candle, c candlestick.Candle) bool) []candlestick.Candle {
+	result := make([]candlestick.Candle, 0)
+	var bar *candlestick.Candle
+	for _, c := range candles {
+		if c.Missing {
+			continue
+		}
+		if bar == nil {
+			start := c
+			bar = &start
+		} else {
+			bar.High = math.Max(bar.High, c.High)
+			bar.Low = math.Min(bar.Low, c.Low)
+			bar.Close = c.Close
+			bar.Volume += c.Volume
+			bar.TakerVolume += c.TakerVolume
+			bar.NumberOfTrades += c.NumberOfTrades
+		}
+		if full(bar, c) {
+			result = append(result, *bar)
+			bar = nil
+		}
+	}
+	if bar != nil {
+		result = append(result, *bar)
+	}
+	return result
+}
+
+// renko emits bricks of size whenever the close moves a brick beyond the last one,
+// reversals need a move of two bricks. Volume is booked on the first brick a candle
+// completes. Sizes lost in the precision of the price and moves building more than
+// maxBricks bricks are refused.
+func renko(candles []candlestick.Candle, size float64) ([]candlestick.Candle, error) {
+	result := make([]candlestick.Candle, 0)
+	var top, bottom float64
+	started := false
+	volume, takerVolume, trades := 0.0, 0.0, int64(0)
+
+	for _, c := range candles {
+		if c.Missing {
+			continue
+		}
+		if !started {
+			bottom = math.Floor(c.Close/size) * size
+			top = bottom + size
+			if top+size == top || bottom-size == bottom {
+				return nil, errBrickSize
+			}
+			started = true
+		}
+		volume += c.Volume
+		takerVolume += c.TakerVolume
+		trades += c.NumberOfTrades
+
+		for c.Close >= top+size || c.Close <= bottom-size {
+			brick := candlestick.Candle{Time: c.Time, Volume: volume, TakerVolume: takerVolume, NumberOfTrades: trades}
+			if c.Close >= top+size {
+				brick.Open, brick.Close = top, top+size
+				bottom, top = top, top+size
+			} else {
+				brick.Open, brick.Close = bottom, bottom-size
+				top, bottom = bottom, bottom-size
+			}
+			brick.High = math.Max(brick.Open, brick.Close)
+			brick.Low = math.Min(brick.Open, brick.Close)
+			result = append(result, brick)
+			if len(result) > maxBricks {
+				return nil, errTooManyBricks
+			}
+			volume, takerVolume, trades = 0, 0, 0
+		}
+	}
+	return result, nil
+}
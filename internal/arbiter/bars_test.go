@@ -0,0 +1,71 @@
+package arbiter
+
+import (
+	"github.com/godoji/candlestick"
+	"testing"
+)
+
+func closes(prices ...float64) []candlestick.Candle {
+	candles := make([]candlestick.Candle, len(prices))
+	for i, p := range prices {
+		candles[i] = candlestick.Candle{Time: int64(i) * candlestick.Interval1m, Open: p, High: p, Low: p, Close: p, Volume: 1}
+	}
+	return candles
+}
+
+func TestRenko(t *testing.T) {
+	tests := []struct {
+		name    string
+		candles []candlestick.Candle
+		size    float64
+		bricks  []float64 // closes of the expected bricks
+		invalid bool
+	}{
+		{
+			name:    "up and reversal",
+			candles: closes(100, 125, 95),
+			size:    10,
+			bricks:  []float64{120, 100},
+		},
+		{
+			name:    "below a brick",
+			candles: closes(100, 105, 95),
+			size:    10,
+		},
+		{
+			name:    "size below price precision",
+			candles: closes(37000, 37100),
+			size:    1e-20,
+			invalid: true,
+		},
+		{
+			name:    "too many bricks",
+			candles: closes(37000, 37100),
+			size:    1e-7,
+			invalid: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			bricks, err := TransformBars(test.candles, BarTransform{Type: BarsRenko, Size: test.size})
+			if test.invalid {
+				if err == nil {
+					t.Fatalf("got %d bricks, want an error", len(bricks))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(bricks) != len(test.bricks) {
+				t.Fatalf("got %d bricks, want %d", len(bricks), len(test.bricks))
+			}
+			for i, b := range bricks {
+				if b.Close != test.bricks[i] {
+					t.Errorf("brick %d closes at %g, want %g", i, b.Close, test.bricks[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package arbiter
+
+import (
+	"context"
+	"github.com/godoji/candlestick"
+	"marlin/internal/composite"
+	"marlin/internal/config"
+	"marlin/internal/logger"
+	"marlin/internal/quote"
+	"marlin/internal/throw"
+	"sort"
+	"strings"
+)
+
+// FetchCompositeHistorical is FetchHistorical of a composite source, it also returns
+// which venues the candles came from
+func FetchCompositeHistorical(ctx context.Context, target candlestick.AssetIdentifier, from int64, interval int64) ([]candlestick.Candle, []composite.Span, throw.Exception) {
+	return fetchComposite(ctx, target, interval, func(venue candlestick.AssetIdentifier) ([]candlestick.Candle, throw.Exception) {
+		return FetchHistorical(ctx, venue, from, interval)
+	})
+}
+
+// FetchCompositeLatest is FetchLatest of a composite source, it also returns which
+// venues the candles came from
+func FetchCompositeLatest(ctx context.Context, target candlestick.AssetIdentifier, from int64) ([]candlestick.Candle, []composite.Span, throw.Exception) {
+	return fetchComposite(ctx, target, candlestick.Interval1m, func(venue candlestick.AssetIdentifier) ([]candlestick.Candle, throw.Exception) {
+		return FetchLatest(ctx, venue, from)
+	})
+}
+
+// fetchComposite fetches the venues of a composite source with fetch and merges them.
+// Fallback sources only ask the next venue while the candles so far have gaps, a venue
+// which fails is skipped as long as another one answers.
+func fetchComposite(ctx context.Context, target candlestick.AssetIdentifier, interval int64, fetch func(venue candlestick.AssetIdentifier) ([]candlestick.Candle, throw.Exception)) ([]candlestick.Candle, []composite.Span, throw.Exception) {
+	mode := target.Exchange
+	if mode != composite.ModeFallback && mode != composite.ModeConsensus {
+		return nil, nil, throw.ErrInvalidExchange
+	}
+	venues := compositeVenues(target.Symbol)
+	if len(venues) == 0 {
+		return nil, nil, throw.ErrInvalidSymbol
+	}
+
+	names := make([]string, 0, len(venues))
+	lists := make([][]candlestick.Candle, 0, len(venues))
+	var candles []candlestick.Candle
+	var sources []string
+	var failed throw.Exception
+	for _, venue := range venues {
+		if mode == composite.ModeFallback && len(lists) > 0 && !hasMissing(candles) {
+			break
+		}
+		if ex := throw.FromContext(ctx); ex != nil {
+			return nil, nil, ex
+		}
+		list, ex := fetch(venue)
+		if ex != nil {
+			logger.Ctx(ctx).Warn("composite venue failed",
+				logger.F("symbol", target.ToString()),
+				logger.F("venue", venue.ToString()),
+				logger.F("error", ex),
+			)
+			if failed == nil {
+				failed = ex
+			}
+			continue
+		}
+		names = append(names, venue.Broker)
+		lists = append(lists, list)
+		candles, sources = composite.Merge(mode, names, lists)
+	}
+	if len(lists) == 0 {
+		return nil, nil, failed
+	}
+	return candles, composite.Spans(candles, sources, interval), nil
+}
+
+// compositeVenues returns the dollar quoted spot markets of base on the configured
+// venues, in order of priority
+func compositeVenues(base string) []candlestick.AssetIdentifier {
+	info := ExchangeInfo()
+	venues := make([]candlestick.AssetIdentifier, 0)
+	for _, broker := range config.ServiceConfig().CompositeVenues() {
+		for _, exchange := range info.Exchanges {
+			if exchange.BrokerId != broker || exchange.ExchangeId != "SPOT" {
+				continue
+			}
+			keys := make([]string, 0)
+			for key, asset := range exchange.Symbols {
+				if strings.EqualFold(asset.BaseAsset, base) && quote.IsDollar(strings.ToUpper(asset.QuoteAsset)) {
+					keys = append(keys, key)
+				}
+			}
+			if len(keys) == 0 {
+				continue
+			}
+			sort.Strings(keys)
+			if venue, ok := candlestick.ParseSymbol(keys[0]); ok {
+				venues = append(venues, venue)
+			}
+		}
+	}
+	return venues
+}
+
+func hasMissing(candles []candlestick.Candle) bool {
+	for _, c := range candles {
+		if c.Missing {
+			return true
+		}
+	}
+	return false
+}
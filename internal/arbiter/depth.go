@@ -0,0 +1,71 @@
+package arbiter
+
+import (
+	"context"
+	"github.com/godoji/candlestick"
+	"marlin/internal/binance"
+	"marlin/internal/config"
+	"marlin/internal/depth"
+	"marlin/internal/logger"
+	"marlin/internal/throw"
+)
+
+func FetchDepth(ctx context.Context, target candlestick.AssetIdentifier, limit int) (*depth.Snapshot, throw.Exception) {
+	switch target.Broker {
+	case config.SourceBinance:
+		if config.ServiceConfig().IsOffline() {
+			return nil, throw.ErrOffline
+		}
+		return binance.FetchDepth(ctx, target, limit)
+	case config.SourceUnicorn, config.SourceCoinbase, config.SourceSynth, config.SourceComposite:
+		return nil, throw.ErrSourceNotSupported
+	default:
+		return nil, throw.ErrInvalidSource
+	}
+}
+
+// DepthAt returns the recorded snapshot of target at or before t
+func DepthAt(target candlestick.AssetIdentifier, t int64) (*depth.Snapshot, throw.Exception) {
+	s, ok, err := depth.At(target, t)
+	if err != nil {
+		return nil, throw.New(err, throw.ErrKindUnexpected)
+	}
+	if !ok {
+		return nil, throw.ErrNoDepthRecorded
+	}
+	return s, nil
+}
+
+// StartDepthRecorder records the order books of all Binance symbols until shutdown
+func StartDepthRecorder() {
+	c := config.ServiceConfig().DepthRecorder()
+	if !c.Enabled || config.ServiceConfig().IsOffline() {
+		return
+	}
+
+	for _, exchange := range ExchangeInfo().Exchanges {
+		if exchange.BrokerId != config.SourceBinance {
+			continue
+		}
+
+		// all symbols of an exchange share as few combined streams as possible
+		exchangeId := exchange.ExchangeId
+		targets := make(map[string]candlestick.AssetIdentifier, len(exchange.Symbols))
+		symbols := make([]string, 0, len(exchange.Symbols))
+		for _, asset := range exchange.Symbols {
+			targets[asset.Identifier.Symbol] = asset.Identifier
+			symbols = append(symbols, asset.Identifier.Symbol)
+		}
+		backgroundTasks.Add(1)
+		go func() {
+			defer backgroundTasks.Done()
+			binance.RecordDepth(backgroundCtx, exchangeId, symbols, c.Interval, c.Levels, func(symbol string, s *depth.Snapshot) {
+				target := targets[symbol]
+				if err := depth.Save(target, s); err != nil {
+					logger.Error("could not save depth snapshot", logger.F("symbol", target.ToString()), logger.F("error", err))
+				}
+			})
+		}()
+	}
+	logger.Info("depth recorder started", logger.F("interval", c.Interval.String()))
+}
@@ -0,0 +1,81 @@
+package arbiter
+
+import (
+	"github.com/godoji/candlestick"
+	"marlin/internal/config"
+	"marlin/internal/gaps"
+	"marlin/internal/logger"
+	"time"
+)
+
+// gaps which are still missing after this many checks are considered upstream outages
+const maxGapChecks = 5
+
+// how often the gap index is written to disk
+const gapFlushInterval = time.Minute
+
+// StartGapChecks periodically retries fetching recorded gaps until shutdown
+func StartGapChecks() {
+	every := config.ServiceConfig().GapRecheckInterval()
+	if every <= 0 || config.ServiceConfig().IsOffline() {
+		return
+	}
+
+	backgroundTasks.Add(1)
+	go func() {
+		defer backgroundTasks.Done()
+		recheck := time.NewTicker(every)
+		defer recheck.Stop()
+		flush := time.NewTicker(gapFlushInterval)
+		defer flush.Stop()
+		for {
+			select {
+			case <-backgroundCtx.Done():
+				return
+			case <-flush.C:
+				gaps.Flush()
+			case <-recheck.C:
+				recheckGaps(every)
+			}
+		}
+	}()
+}
+
+func recheckGaps(every time.Duration) {
+	now := time.Now().UTC()
+	resolved, remaining := 0, 0
+	for _, g := range gaps.Find(nil, 0, 0) {
+		if g.Checks >= maxGapChecks || now.Sub(time.Unix(g.LastChecked, 0)) < every {
+			continue
+		}
+		if backgroundCtx.Err() != nil {
+			return
+		}
+
+		// merged gaps can span several blocks, all of them have to be complete
+		missing := 0
+		ex := WalkHistorical(backgroundCtx, g.Identifier(), g.Start, g.End(), g.Interval, func(candles []candlestick.Candle) bool {
+			for _, c := range candles {
+				if c.Missing {
+					missing++
+				}
+			}
+			return true
+		})
+		if ex != nil {
+			logger.Warn("gap recheck failed", logger.F("symbol", g.Identifier().ToString()), logger.F("start", g.Start), logger.F("error", ex))
+			continue
+		}
+
+		// fetching records the gap again, resolve the entry the check started from
+		if missing == 0 {
+			gaps.Resolve(g)
+			resolved++
+		} else {
+			gaps.Checked(g)
+			remaining++
+		}
+	}
+	gaps.Flush()
+	logger.Info("gaps rechecked", logger.F("resolved", resolved), logger.F("remaining", remaining))
+}
@@ -0,0 +1,149 @@
+package arbiter
+
+import (
+	"context"
+	"github.com/godoji/candlestick"
+	"marlin/internal/binance"
+	"marlin/internal/coinbase"
+	"marlin/internal/config"
+	"marlin/internal/indicators"
+	"marlin/internal/logger"
+	"marlin/internal/throw"
+	"time"
+)
+
+// FetchIndicator computes an indicator over the historical block at from, the candles
+// before the block are fetched as well so the first points are warmed up. Paged
+// sources are computed and cached in blocks on a fixed grid, a block at any other
+// from is put together from the two grid blocks it overlaps.
+func FetchIndicator(ctx context.Context, target candlestick.AssetIdentifier, spec indicators.Spec, from int64, interval int64) ([]indicators.Point, throw.Exception) {
+	size := int64(blockSize(target))
+	if size == 0 || from <= 0 || interval <= 0 {
+		return computeIndicator(ctx, target, spec, from, interval)
+	}
+	if rem := from % interval; rem != 0 {
+		from += interval - rem
+	}
+
+	span := size * interval
+	now := time.Now().UTC().Unix()
+	points := make([]indicators.Point, 0, size)
+	for start := from - from%span; start < from+span && start <= now; start += span {
+		block, ex := indicatorBlock(ctx, target, spec, start, interval)
+		if ex != nil {
+			return nil, ex
+		}
+		for _, p := range block {
+			if p.Time >= from && p.Time < from+span {
+				points = append(points, p)
+			}
+		}
+	}
+	return points, nil
+}
+
+// indicatorBlock returns the points of the grid block at start, settled blocks are
+// read from and written to the cache
+func indicatorBlock(ctx context.Context, target candlestick.AssetIdentifier, spec indicators.Spec, start int64, interval int64) ([]indicators.Point, throw.Exception) {
+	if points, ok, err := indicators.Cached(target, interval, spec, start); err != nil {
+		logger.Ctx(ctx).Warn("could not read cached indicator", logger.F("indicator", spec.Key()), logger.F("error", err))
+	} else if ok {
+		return points, nil
+	}
+
+	warmup, candles, ex := fetchIndicatorCandles(ctx, target, spec, start, interval)
+	if ex != nil {
+		return nil, ex
+	}
+	points := indicatorPoints(warmup, candles, spec, start)
+
+	if isSettled(target, warmup, candles, interval, spec.Warmup()) {
+		if err := indicators.Cache(target, interval, spec, start, points); err != nil {
+			logger.Ctx(ctx).Warn("could not cache indicator", logger.F("indicator", spec.Key()), logger.F("error", err))
+		}
+	}
+	return points, nil
+}
+
+// computeIndicator computes the points of sources which are not cached
+func computeIndicator(ctx context.Context, target candlestick.AssetIdentifier, spec indicators.Spec, from int64, interval int64) ([]indicators.Point, throw.Exception) {
+	warmup, candles, ex := fetchIndicatorCandles(ctx, target, spec, from, interval)
+	if ex != nil {
+		return nil, ex
+	}
+	return indicatorPoints(warmup, candles, spec, from), nil
+}
+
+// fetchIndicatorCandles returns the block at from and the warm-up candles before it
+func fetchIndicatorCandles(ctx context.Context, target candlestick.AssetIdentifier, spec indicators.Spec, from int64, interval int64) ([]candlestick.Candle, []candlestick.Candle, throw.Exception) {
+	candles, ex := FetchHistorical(ctx, target, from, interval)
+	if ex != nil {
+		return nil, nil, ex
+	}
+
+	// sources which return their whole history already include the warm-up
+	warmup := make([]candlestick.Candle, 0)
+	if w := int64(spec.Warmup()); w > 0 && from > 0 && (len(candles) == 0 || candles[0].Time >= from) {
+		ex = WalkHistorical(ctx, target, from-w*interval, from, interval, func(block []candlestick.Candle) bool {
+			warmup = append(warmup, block...)
+			return true
+		})
+		if ex != nil {
+			return nil, nil, ex
+		}
+	}
+	return warmup, candles, nil
+}
+
+// indicatorPoints computes the indicator over warmup and candles and drops the points
+// before from
+func indicatorPoints(warmup []candlestick.Candle, candles []candlestick.Candle, spec indicators.Spec, from int64) []indicators.Point {
+	points := indicators.Compute(append(warmup, candles...), spec)
+	skip := len(warmup)
+	for skip < len(points) && points[skip].Time < from {
+		skip++
+	}
+	return points[skip:]
+}
+
+// blockSize returns the number of candles per historical block of paged sources, or
+// zero for sources which return their whole history at once
+func blockSize(target candlestick.AssetIdentifier) int {
+	switch target.Broker {
+	case config.SourceBinance:
+		return binance.BlockSize
+	case config.SourceCoinbase:
+		return coinbase.BlockSize
+	default:
+		return 0
+	}
+}
+
+// isSettled reports whether a historical block and the warm-up before it are
+// complete and in the past, so anything derived from them can be kept. Blocks with
+// gaps are not, the gap checks may still fill them in, only candles from before the
+// listing stay missing for good.
+func isSettled(target candlestick.AssetIdentifier, warmup []candlestick.Candle, candles []candlestick.Candle, interval int64, warmupSize int) bool {
+	size := blockSize(target)
+	if size == 0 {
+		// whole histories grow every day and get adjusted for splits
+		return false
+	}
+
+	n := len(candles)
+	if n != size || len(warmup) < warmupSize || candles[n-1].Time+interval > time.Now().UTC().Unix() {
+		return false
+	}
+	listed := listedAt(target)
+	for _, c := range warmup[len(warmup)-warmupSize:] {
+		if c.Missing && c.Time >= listed {
+			return false
+		}
+	}
+	for _, c := range candles {
+		if c.Missing && c.Time >= listed {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,98 @@
+package arbiter
+
+import (
+	"github.com/godoji/candlestick"
+	"marlin/internal/gaps"
+	"marlin/internal/store"
+	"marlin/internal/throw"
+	"time"
+)
+
+// storedHistory serves the full history of target from the local store
+func storedHistory(target candlestick.AssetIdentifier, interval int64) ([]candlestick.Candle, throw.Exception) {
+	candles, err := store.GetAll(target, interval)
+	if err != nil {
+		return nil, throw.New(err, throw.ErrKindUnexpected)
+	}
+	if len(candles) == 0 {
+		return nil, throw.ErrNotStored
+	}
+
+	// missing candles are not stored, they are filled in again to keep the history on
+	// the interval grid like the broker returns it
+	result := make([]candlestick.Candle, 0, len(candles))
+	for _, c := range candles {
+		if n := len(result); n > 0 {
+			for t := result[n-1].Time + interval; t < c.Time; t += interval {
+				result = append(result, candlestick.Candle{Time: t, Missing: true})
+			}
+		}
+		result = append(result, c)
+	}
+	return result, nil
+}
+
+// storedBlock serves size candles starting at from like a paging broker would. Every
+// candle must be stored, lie before the listing or in a recorded gap, those and the
+// candles which lie in the future are filled in as missing.
+func storedBlock(target candlestick.AssetIdentifier, from int64, interval int64, size int64) ([]candlestick.Candle, throw.Exception) {
+	if rem := from % interval; rem != 0 {
+		from += interval - rem
+	}
+	end := from + size*interval
+	available := end
+	if now := time.Now().UTC().Unix(); now < available {
+		available = now - now%interval
+	}
+
+	byTime := make(map[int64]candlestick.Candle)
+	var known []gaps.Gap
+	if available > from {
+		stored, err := store.Get(target, interval, from, available)
+		if err != nil {
+			return nil, throw.New(err, throw.ErrKindUnexpected)
+		}
+		for _, c := range stored {
+			byTime[c.Time] = c
+		}
+		for _, g := range gaps.Find(target, from, available) {
+			if g.Interval == interval {
+				known = append(known, g)
+			}
+		}
+	}
+	listed := listedAt(target)
+	inGap := func(t int64) bool {
+		for _, g := range known {
+			if t >= g.Start && t < g.End() {
+				return true
+			}
+		}
+		return false
+	}
+
+	candles := make([]candlestick.Candle, 0, size)
+	for t := from; t < end; t += interval {
+		if c, ok := byTime[t]; ok {
+			candles = append(candles, c)
+			continue
+		}
+		if t < available && t >= listed && !inGap(t) {
+			return nil, throw.ErrNotStored
+		}
+		candles = append(candles, candlestick.Candle{Time: t, Missing: true})
+	}
+	return candles, nil
+}
+
+// storedLatest serves up to size stored candles starting at from
+func storedLatest(target candlestick.AssetIdentifier, from int64, interval int64, size int64) ([]candlestick.Candle, throw.Exception) {
+	candles, err := store.Get(target, interval, from, from+size*interval)
+	if err != nil {
+		return nil, throw.New(err, throw.ErrKindUnexpected)
+	}
+	if len(candles) == 0 {
+		return nil, throw.ErrNotStored
+	}
+	return candles, nil
+}
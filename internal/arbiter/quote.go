@@ -0,0 +1,136 @@
+package arbiter
+
+import (
+	"context"
+	"github.com/godoji/candlestick"
+	"marlin/internal/binance"
+	"marlin/internal/config"
+	"marlin/internal/quote"
+	"marlin/internal/throw"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+var currencyPattern = regexp.MustCompile(`^[A-Z0-9]{2,10}$`)
+
+// daily rates are kept for an hour instead of being fetched per block, currencies
+// without rates are remembered as long
+const dailyTTL = time.Hour
+
+type dailyEntry struct {
+	rates   *quote.Rates // nil when the currency has no rates
+	fetched time.Time
+}
+
+var dailyCache = make(map[string]dailyEntry)
+var dailyLock = sync.Mutex{}
+
+// ConvertQuote converts candles of target with the given interval into currency. Crypto
+// currencies are converted with their Binance USDT pair and others with daily forex
+// rates, any other rate goes through the US dollar.
+func ConvertQuote(ctx context.Context, target candlestick.AssetIdentifier, candles []candlestick.Candle, interval int64, currency string) ([]candlestick.Candle, throw.Exception) {
+	currency = strings.ToUpper(currency)
+	if !currencyPattern.MatchString(currency) {
+		return nil, throw.ErrInvalidQuote
+	}
+	source, ex := quoteAsset(target)
+	if ex != nil {
+		return nil, ex
+	}
+	if len(candles) == 0 || source == currency || (quote.IsDollar(source) && quote.IsDollar(currency)) {
+		return candles, nil
+	}
+
+	from, to := candles[0].Time, candles[len(candles)-1].Time+interval
+	fromRates, ex := dollarRates(ctx, source, from, to, interval)
+	if ex != nil {
+		return nil, ex
+	}
+	toRates, ex := dollarRates(ctx, currency, from, to, interval)
+	if ex != nil {
+		return nil, ex
+	}
+	converter := quote.Converter{From: fromRates, To: toRates}
+	return converter.Convert(candles, interval), nil
+}
+
+func quoteAsset(target candlestick.AssetIdentifier) (string, throw.Exception) {
+	switch target.Broker {
+	case config.SourceSynth:
+		return "", throw.ErrQuoteNotSupported
+	case config.SourceComposite:
+		// composite sources only merge dollar quoted markets
+		return "USD", nil
+	}
+	for _, exchange := range ExchangeInfo().Exchanges {
+		if asset, ok := exchange.Symbols[target.ToString()]; ok {
+			return strings.ToUpper(asset.QuoteAsset), nil
+		}
+	}
+	return "", throw.ErrInvalidSymbol
+}
+
+// dollarRates returns the price of currency in US dollars over [from, to)
+func dollarRates(ctx context.Context, currency string, from int64, to int64, interval int64) (*quote.Rates, throw.Exception) {
+	if quote.IsDollar(currency) {
+		return nil, nil
+	}
+
+	// crypto currencies are priced by the minute for minute candles, anything longer
+	// is converted with daily rates
+	pair := candlestick.NewAssetIdentifier(config.SourceBinance, "SPOT", currency+"USDT")
+	_, ex := quoteAsset(pair)
+	isCrypto := ex == nil
+	if isCrypto && interval == candlestick.Interval1m {
+		maxAge := 10 * interval
+		candles := make([]candlestick.Candle, 0)
+		ex = WalkHistorical(ctx, pair, from-maxAge, to, interval, func(block []candlestick.Candle) bool {
+			candles = append(candles, block...)
+			return true
+		})
+		if ex != nil {
+			return nil, ex
+		}
+		return quote.NewRates(candles, interval, maxAge), nil
+	}
+
+	dailyLock.Lock()
+	entry, ok := dailyCache[currency]
+	dailyLock.Unlock()
+	if ok && time.Since(entry.fetched) < dailyTTL {
+		if entry.rates == nil {
+			return nil, throw.ErrQuoteNotSupported
+		}
+		return entry.rates, nil
+	}
+
+	var candles []candlestick.Candle
+	if isCrypto {
+		candles, ex = binance.FetchDailyCandles(ctx, pair.Symbol)
+	} else {
+		forex := candlestick.NewAssetIdentifier(config.SourceUnicorn, "FOREX", currency+"USD")
+		candles, ex = FetchHistorical(ctx, forex, 0, candlestick.Interval1d)
+		// unknown currencies are not forex tickers
+		if ex != nil && ex.Code == throw.ErrNotFound.Code {
+			candles, ex = nil, nil
+		}
+	}
+	if ex != nil {
+		return nil, ex
+	}
+
+	// daily rates are kept over weekends, holidays and gaps
+	var rates *quote.Rates
+	if len(candles) > 0 {
+		rates = quote.NewRates(candles, candlestick.Interval1d, 4*candlestick.Interval1d)
+	}
+	dailyLock.Lock()
+	dailyCache[currency] = dailyEntry{rates: rates, fetched: time.Now()}
+	dailyLock.Unlock()
+	if rates == nil {
+		return nil, throw.ErrQuoteNotSupported
+	}
+	return rates, nil
+}
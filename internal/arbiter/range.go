@@ -0,0 +1,98 @@
+package arbiter
+
+import (
+	"context"
+	"github.com/godoji/candlestick"
+	"marlin/internal/config"
+	"marlin/internal/synth"
+	"marlin/internal/throw"
+	"time"
+)
+
+// WalkHistorical fetches all candles in [from, to) block by block and hands each
+// block to fn, walking stops early when fn returns false
+func WalkHistorical(ctx context.Context, target candlestick.AssetIdentifier, from int64, to int64, interval int64, fn func(candles []candlestick.Candle) bool) throw.Exception {
+
+	// never walk into the future, those blocks are only filled with missing candles
+	if now := time.Now().UTC().Unix(); to > now {
+		to = now
+	}
+
+	paged := isPaged(target)
+	cursor := from
+	for cursor < to {
+		// stop paging as soon as the caller is gone
+		if ex := throw.FromContext(ctx); ex != nil {
+			return ex
+		}
+		candles, ex := FetchHistorical(ctx, target, cursor, interval)
+		if ex != nil {
+			return ex
+		}
+
+		block := make([]candlestick.Candle, 0, len(candles))
+		next := cursor
+		for _, c := range candles {
+			if c.Time >= cursor && c.Time < to {
+				block = append(block, c)
+			}
+			if c.Time+interval > next {
+				next = c.Time + interval
+			}
+		}
+
+		if len(block) > 0 && !fn(block) {
+			return nil
+		}
+
+		// sources without paging return everything at once, asking again would download
+		// the whole history once more
+		if !paged || next <= cursor || len(candles) == 0 {
+			return nil
+		}
+		cursor = next
+	}
+
+	return nil
+}
+
+// isPaged reports whether historical requests of target return a block starting at
+// from, unpaged sources return their whole history on every request
+func isPaged(target candlestick.AssetIdentifier) bool {
+	switch target.Broker {
+	case config.SourceUnicorn:
+		return false
+	case config.SourceSynth:
+		instrument, err := synth.Parse(target)
+		if err != nil {
+			// the fetch reports the invalid symbol
+			return true
+		}
+		for _, leg := range instrument.Legs {
+			if !isPaged(leg) {
+				return false
+			}
+		}
+		return true
+	case config.SourceComposite:
+		for _, venue := range compositeVenues(target.Symbol) {
+			if !isPaged(venue) {
+				return false
+			}
+		}
+		return true
+	default:
+		return true
+	}
+}
+
+// DropMissing removes placeholder candles which were filled in for gaps
+func DropMissing(candles []candlestick.Candle) []candlestick.Candle {
+	result := make([]candlestick.Candle, 0, len(candles))
+	for _, c := range candles {
+		if !c.Missing {
+			result = append(result, c)
+		}
+	}
+	return result
+}
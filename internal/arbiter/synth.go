@@ -0,0 +1,28 @@
+package arbiter
+
+import (
+	"context"
+	"github.com/godoji/candlestick"
+	"marlin/internal/synth"
+	"marlin/internal/throw"
+)
+
+// fetchSynthetic fetches both legs of a synthetic instrument with fetch and combines them
+func fetchSynthetic(ctx context.Context, target candlestick.AssetIdentifier, fetch func(leg candlestick.AssetIdentifier) ([]candlestick.Candle, throw.Exception)) ([]candlestick.Candle, throw.Exception) {
+	instrument, err := synth.Parse(target)
+	if err != nil {
+		return nil, throw.Wrap(err, throw.ErrInvalidSymbol)
+	}
+
+	var legs [2][]candlestick.Candle
+	for i, leg := range instrument.Legs {
+		if ex := throw.FromContext(ctx); ex != nil {
+			return nil, ex
+		}
+		var ex throw.Exception
+		if legs[i], ex = fetch(leg); ex != nil {
+			return nil, ex
+		}
+	}
+	return instrument.Combine(legs[0], legs[1]), nil
+}
@@ -0,0 +1,58 @@
+package arbiter
+
+import (
+	"context"
+	"github.com/godoji/candlestick"
+	"marlin/internal/binance"
+	"marlin/internal/config"
+	"marlin/internal/throw"
+	"marlin/internal/trades"
+)
+
+// largest page of trades requested from a broker
+const TradesPageSize = 1000
+
+// FetchTrades returns a page of up to limit trades before to, starting at trade fromId
+// or at from when fromId is negative. An empty page may come with the time to continue
+// from when a long range without trades was cut short.
+func FetchTrades(ctx context.Context, target candlestick.AssetIdentifier, fromId int64, from int64, to int64, limit int) ([]trades.Trade, int64, throw.Exception) {
+	switch target.Broker {
+	case config.SourceBinance:
+		if config.ServiceConfig().IsOffline() {
+			return nil, 0, throw.ErrOffline
+		}
+		return binance.FetchTrades(ctx, target, fromId, from, to, limit)
+	case config.SourceUnicorn, config.SourceCoinbase, config.SourceSynth, config.SourceComposite:
+		return nil, 0, throw.ErrSourceNotSupported
+	default:
+		return nil, 0, throw.ErrInvalidSource
+	}
+}
+
+// WalkTrades fetches all trades in [from, to) page by page and hands each page to fn,
+// walking stops early when fn returns false
+func WalkTrades(ctx context.Context, target candlestick.AssetIdentifier, from int64, to int64, fn func(page []trades.Trade) bool) throw.Exception {
+	fromId := int64(-1)
+	for {
+		if ex := throw.FromContext(ctx); ex != nil {
+			return ex
+		}
+		page, next, ex := FetchTrades(ctx, target, fromId, from, to, TradesPageSize)
+		if ex != nil {
+			return ex
+		}
+		if len(page) == 0 && next > 0 {
+			from = next
+			continue
+		}
+		if len(page) == 0 || !fn(page) {
+			return nil
+		}
+
+		// a short page by id means the end of the range or of all trades was reached
+		if fromId >= 0 && len(page) < TradesPageSize {
+			return nil
+		}
+		fromId = page[len(page)-1].Id + 1
+	}
+}
@@ -0,0 +1,100 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"marlin/internal/logger"
+	"os"
+	"strings"
+	"sync"
+)
+
+// KeyConfig describes one client as stored in the key file, the key itself is
+// never stored, only its hex encoded sha256 hash
+type KeyConfig struct {
+	Name       string  `json:"name"`
+	Hash       string  `json:"hash"`
+	Rate       float64 `json:"rate"`
+	Burst      int     `json:"burst"`
+	DailyQuota int64   `json:"dailyQuota"`
+}
+
+type Client struct {
+	config  KeyConfig
+	hash    []byte
+	limiter *limiter
+}
+
+func (c *Client) Name() string {
+	return c.config.Name
+}
+
+var clientsLock = sync.Mutex{}
+var clients []*Client = nil
+
+func HashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// LoadKeys reads the key file, the service runs anonymously when no file is configured
+func LoadKeys(path string) {
+	clientsLock.Lock()
+	defer clientsLock.Unlock()
+
+	if path == "" {
+		clients = nil
+		return
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		logger.Fatal("could not read api keys", logger.F("path", path), logger.F("error", err))
+	}
+
+	configs := make([]KeyConfig, 0)
+	if err = json.Unmarshal(data, &configs); err != nil {
+		logger.Fatal("could not decode api keys", logger.F("path", path), logger.F("error", err))
+	}
+
+	clients = make([]*Client, 0, len(configs))
+	for _, c := range configs {
+		hash, err := hex.DecodeString(strings.ToLower(c.Hash))
+		if err != nil || len(hash) != sha256.Size {
+			logger.Fatal("invalid hash for api key", logger.F("client", c.Name))
+		}
+		clients = append(clients, &Client{
+			config:  c,
+			hash:    hash,
+			limiter: newLimiter(c.Rate, c.Burst, c.DailyQuota),
+		})
+	}
+
+	logger.Info("api keys loaded", logger.F("keys", len(clients)))
+}
+
+// IsEnabled reports whether requests have to be authenticated
+func IsEnabled() bool {
+	clientsLock.Lock()
+	defer clientsLock.Unlock()
+	return clients != nil
+}
+
+// Lookup returns the client owning the key
+func Lookup(key string) (*Client, bool) {
+	if key == "" {
+		return nil, false
+	}
+	sum := sha256.Sum256([]byte(key))
+
+	clientsLock.Lock()
+	defer clientsLock.Unlock()
+	for _, c := range clients {
+		if subtle.ConstantTimeCompare(c.hash, sum[:]) == 1 {
+			return c, true
+		}
+	}
+	return nil, false
+}
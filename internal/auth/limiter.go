@@ -0,0 +1,83 @@
+package auth
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// limiter combines a token bucket for request rates with a daily quota on
+// requests which cost upstream weight or credits
+type limiter struct {
+	lock       sync.Mutex
+	rate       float64
+	burst      float64
+	tokens     float64
+	last       time.Time
+	dailyQuota int64
+	used       int64
+	day        int64
+}
+
+func newLimiter(rate float64, burst int, dailyQuota int64) *limiter {
+	if burst <= 0 {
+		burst = int(math.Max(1, math.Ceil(rate)))
+	}
+	return &limiter{
+		rate:       rate,
+		burst:      float64(burst),
+		tokens:     float64(burst),
+		last:       time.Now(),
+		dailyQuota: dailyQuota,
+	}
+}
+
+// Allow takes a token from the bucket, when denied it returns how long to wait
+// before the next request can succeed. A rate of zero disables rate limiting.
+func (c *Client) Allow() (bool, time.Duration) {
+	l := c.limiter
+	if l.rate <= 0 {
+		return true, 0
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	now := time.Now()
+	l.tokens = math.Min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+
+	if l.tokens < 1 {
+		wait := time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+		return false, wait
+	}
+	l.tokens--
+	return true, 0
+}
+
+// Consume counts one upstream costly request against the daily quota, when the
+// quota is exhausted it returns the time until the quota resets at midnight UTC.
+// A quota of zero means unlimited.
+func (c *Client) Consume() (bool, time.Duration) {
+	l := c.limiter
+	if l.dailyQuota <= 0 {
+		return true, 0
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	now := time.Now().UTC()
+	day := now.Unix() / (24 * 60 * 60)
+	if day != l.day {
+		l.day = day
+		l.used = 0
+	}
+
+	if l.used >= l.dailyQuota {
+		reset := time.Unix((day+1)*24*60*60, 0)
+		return false, reset.Sub(now)
+	}
+	l.used++
+	return true, 0
+}
@@ -0,0 +1,293 @@
+package backfill
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/godoji/candlestick"
+	"io"
+	"marlin/internal/arbiter"
+	"marlin/internal/atomicfile"
+	"marlin/internal/config"
+	"marlin/internal/logger"
+	"marlin/internal/throw"
+	"marlin/internal/tracing"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const jobsPath = "./data/jobs.json"
+
+// job states
+const (
+	StatusQueued    = "queued"
+	StatusRunning   = "running"
+	StatusDone      = "done"
+	StatusFailed    = "failed"
+	StatusCancelled = "cancelled"
+)
+
+// Spec describes what a job downloads, exchanges are given as BROKER:EXCHANGE and
+// expand to every symbol listed on that exchange
+type Spec struct {
+	Symbols   []string `json:"symbols"`
+	Exchanges []string `json:"exchanges"`
+	From      int64    `json:"from"`
+	To        int64    `json:"to"`
+	Interval  int64    `json:"interval"`
+}
+
+// Target tracks the progress of a single asset within a job
+type Target struct {
+	Symbol  string `json:"symbol"`
+	From    int64  `json:"from"`
+	Cursor  int64  `json:"cursor"`
+	Candles int64  `json:"candles"`
+	Done    bool   `json:"done"`
+}
+
+type Job struct {
+	Id       string    `json:"id"`
+	Status   string    `json:"status"`
+	Interval int64     `json:"interval"`
+	To       int64     `json:"to"`
+	Targets  []*Target `json:"targets"`
+	Created  int64     `json:"created"`
+	Started  int64     `json:"started,omitempty"`
+	Finished int64     `json:"finished,omitempty"`
+	Error    string    `json:"error,omitempty"`
+	Progress float64   `json:"progress"`
+	Eta      int64     `json:"eta,omitempty"`
+
+	// progress made since the job was last (re)started, used to estimate the eta
+	resumed     time.Time
+	resumedDone int64
+	cancel      context.CancelFunc
+}
+
+var jobs map[string]*Job = nil
+var jobsLock = sync.Mutex{}
+var wake = make(chan struct{}, 1)
+
+// done returns how many seconds of the job's ranges have been walked and in total
+func (j *Job) done() (done int64, total int64) {
+	for _, t := range j.Targets {
+		total += j.To - t.From
+		if t.Done {
+			done += j.To - t.From
+		} else {
+			done += t.Cursor - t.From
+		}
+	}
+	return done, total
+}
+
+// snapshot returns a copy of the job with its progress and eta filled in, the lock must be held
+func (j *Job) snapshot() Job {
+	c := *j
+	c.Targets = make([]*Target, len(j.Targets))
+	for i, t := range j.Targets {
+		target := *t
+		c.Targets[i] = &target
+	}
+
+	done, total := j.done()
+	if total > 0 {
+		c.Progress = float64(done) / float64(total)
+	}
+	if j.Status == StatusRunning && done > j.resumedDone {
+		elapsed := time.Since(j.resumed).Seconds()
+		rate := float64(done-j.resumedDone) / elapsed
+		c.Eta = int64(float64(total-done) / rate)
+	}
+	return c
+}
+
+// Submit validates spec and queues a new job
+func Submit(spec Spec) (Job, throw.Exception) {
+	if config.ServiceConfig().IsOffline() {
+		return Job{}, throw.ErrOffline
+	}
+	if spec.Interval <= 0 {
+		return Job{}, throw.ErrInvalidInterval
+	}
+	if spec.To == 0 {
+		spec.To = time.Now().UTC().Unix()
+	}
+	if spec.To <= spec.From {
+		return Job{}, throw.ErrInvalidToParameter
+	}
+
+	targets, ex := expandTargets(spec)
+	if ex != nil {
+		return Job{}, ex
+	}
+
+	jobsLock.Lock()
+	defer jobsLock.Unlock()
+	load()
+
+	job := &Job{
+		Id:       tracing.NewRequestId(),
+		Status:   StatusQueued,
+		Interval: spec.Interval,
+		To:       spec.To,
+		Targets:  targets,
+		Created:  time.Now().UTC().Unix(),
+	}
+	jobs[job.Id] = job
+	save()
+
+	select {
+	case wake <- struct{}{}:
+	default:
+	}
+
+	logger.Info("backfill job queued", logger.F("job", job.Id), logger.F("targets", len(targets)))
+	return job.snapshot(), nil
+}
+
+// expandTargets resolves the symbols and exchanges of spec, each asset starts at the
+// later of the requested start and its on board date
+func expandTargets(spec Spec) ([]*Target, throw.Exception) {
+	info := arbiter.ExchangeInfo()
+
+	assets := make(map[string]*candlestick.AssetInfo)
+	for _, exchange := range info.Exchanges {
+		for id, asset := range exchange.Symbols {
+			assets[id] = asset
+		}
+	}
+
+	identifiers := make([]string, 0)
+	for _, s := range spec.Symbols {
+		target, ok := candlestick.ParseSymbol(s)
+		if !ok {
+			return nil, throw.ErrInvalidSymbol
+		}
+		identifiers = append(identifiers, target.ToString())
+	}
+	for _, e := range spec.Exchanges {
+		parts := strings.Split(e, ":")
+		if len(parts) != 2 {
+			return nil, throw.ErrInvalidExchange
+		}
+		found := false
+		for _, exchange := range info.Exchanges {
+			if exchange.BrokerId != parts[0] || exchange.ExchangeId != parts[1] {
+				continue
+			}
+			found = true
+			for id := range exchange.Symbols {
+				identifiers = append(identifiers, id)
+			}
+		}
+		if !found {
+			return nil, throw.ErrInvalidExchange
+		}
+	}
+	sort.Strings(identifiers)
+
+	targets := make([]*Target, 0, len(identifiers))
+	seen := make(map[string]bool)
+	for _, id := range identifiers {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		from := spec.From
+		if asset, ok := assets[id]; ok && asset.OnBoardDate > from {
+			from = asset.OnBoardDate
+		}
+		if from >= spec.To {
+			continue
+		}
+		targets = append(targets, &Target{Symbol: id, From: from, Cursor: from})
+	}
+
+	if len(targets) == 0 {
+		return nil, throw.ErrNoTargets
+	}
+	return targets, nil
+}
+
+func Get(id string) (Job, bool) {
+	jobsLock.Lock()
+	defer jobsLock.Unlock()
+	load()
+	job, ok := jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return job.snapshot(), true
+}
+
+// List returns all jobs, newest first
+func List() []Job {
+	jobsLock.Lock()
+	defer jobsLock.Unlock()
+	load()
+	result := make([]Job, 0, len(jobs))
+	for _, job := range jobs {
+		result = append(result, job.snapshot())
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Created > result[j].Created })
+	return result
+}
+
+// Cancel stops a queued or running job, finished jobs are left untouched
+func Cancel(id string) (Job, bool) {
+	jobsLock.Lock()
+	defer jobsLock.Unlock()
+	load()
+	job, ok := jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	switch {
+	case job.cancel != nil:
+		// the runner records the cancellation once the job stopped
+		job.cancel()
+	case job.Status == StatusQueued || job.Status == StatusRunning:
+		// jobs interrupted by a restart are running but not picked up yet
+		job.Status = StatusCancelled
+		job.Finished = time.Now().UTC().Unix()
+		save()
+	}
+	return job.snapshot(), true
+}
+
+// save writes all jobs to disk, the lock must be held
+func save() {
+	err := atomicfile.WriteFile(jobsPath, func(w io.Writer) error {
+		return json.NewEncoder(w).Encode(jobs)
+	})
+	if err != nil {
+		logger.Error("could not write backfill jobs", logger.F("error", err))
+	}
+}
+
+// load reads the jobs from disk on first use, the lock must be held
+func load() {
+	if jobs != nil {
+		return
+	}
+	jobs = make(map[string]*Job)
+
+	file, err := os.Open(jobsPath)
+	if os.IsNotExist(err) {
+		return
+	}
+	if err != nil {
+		logger.Error("could not open backfill jobs", logger.F("path", jobsPath), logger.F("error", err))
+		return
+	}
+	defer file.Close()
+	if err = json.NewDecoder(file).Decode(&jobs); err != nil {
+		logger.Error("could not decode backfill jobs, starting empty", logger.F("path", jobsPath), logger.F("error", err))
+		jobs = make(map[string]*Job)
+	}
+}
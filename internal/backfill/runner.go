@@ -0,0 +1,152 @@
+package backfill
+
+import (
+	"context"
+	"github.com/godoji/candlestick"
+	"marlin/internal/arbiter"
+	"marlin/internal/config"
+	"marlin/internal/logger"
+	"marlin/internal/store"
+	"marlin/internal/throw"
+	"time"
+)
+
+// progress is written to disk at most this often while a job runs
+const saveInterval = 5 * time.Second
+
+// Start runs queued jobs one at a time until ctx is cancelled, jobs interrupted by a
+// shutdown stay running on disk and resume from their last cursor on the next start
+func Start(ctx context.Context) {
+	for {
+		RunPending(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-wake:
+		}
+	}
+}
+
+// RunPending runs queued and interrupted jobs until none are left or ctx is cancelled
+func RunPending(ctx context.Context) {
+	// backfills would only copy the store onto itself
+	if config.ServiceConfig().IsOffline() {
+		return
+	}
+	for ctx.Err() == nil {
+		job, jobCtx := next(ctx)
+		if job == nil {
+			return
+		}
+		run(ctx, jobCtx, job)
+	}
+}
+
+// next picks the oldest unfinished job, marks it running and returns the context
+// it runs in, cancelling the job cancels this context
+func next(ctx context.Context) (*Job, context.Context) {
+	jobsLock.Lock()
+	defer jobsLock.Unlock()
+	load()
+
+	var oldest *Job
+	for _, job := range jobs {
+		if job.Status != StatusQueued && job.Status != StatusRunning {
+			continue
+		}
+		if oldest == nil || job.Created < oldest.Created {
+			oldest = job
+		}
+	}
+	if oldest == nil {
+		return nil, nil
+	}
+
+	done, _ := oldest.done()
+	oldest.Status = StatusRunning
+	oldest.resumed = time.Now()
+	oldest.resumedDone = done
+	if oldest.Started == 0 {
+		oldest.Started = time.Now().UTC().Unix()
+	}
+	save()
+
+	jobCtx, cancel := context.WithCancel(ctx)
+	oldest.cancel = cancel
+	return oldest, jobCtx
+}
+
+func run(ctx context.Context, jobCtx context.Context, job *Job) {
+
+	log := logger.With(logger.F("job", job.Id))
+	log.Info("backfill job started", logger.F("targets", len(job.Targets)))
+
+	lastSave := time.Now()
+	var ex throw.Exception
+	for _, t := range job.Targets {
+		if t.Done {
+			continue
+		}
+		target, ok := candlestick.ParseSymbol(t.Symbol)
+		if !ok {
+			ex = throw.ErrInvalidSymbol
+			break
+		}
+
+		var storeErr error
+		ex = arbiter.WalkHistorical(jobCtx, target, t.Cursor, job.To, job.Interval, func(candles []candlestick.Candle) bool {
+			if storeErr = store.Put(target, job.Interval, candles); storeErr != nil {
+				return false
+			}
+
+			jobsLock.Lock()
+			defer jobsLock.Unlock()
+			t.Cursor = candles[len(candles)-1].Time + job.Interval
+			t.Candles += int64(len(candles))
+			if time.Since(lastSave) > saveInterval {
+				save()
+				lastSave = time.Now()
+			}
+			return true
+		})
+		if ex == nil && storeErr != nil {
+			ex = throw.New(storeErr, throw.ErrKindUnexpected)
+		}
+		if ex != nil {
+			break
+		}
+
+		jobsLock.Lock()
+		t.Done = true
+		t.Cursor = job.To
+		save()
+		jobsLock.Unlock()
+		log.Info("backfill target done", logger.F("symbol", t.Symbol), logger.F("candles", t.Candles))
+	}
+
+	jobsLock.Lock()
+	defer jobsLock.Unlock()
+
+	switch {
+	case ex == nil:
+		job.Status = StatusDone
+		job.Finished = time.Now().UTC().Unix()
+		log.Info("backfill job done")
+	case ctx.Err() != nil:
+		// shutting down, resume on the next start
+		log.Info("backfill job interrupted")
+	case jobCtx.Err() != nil:
+		job.Status = StatusCancelled
+		job.Finished = time.Now().UTC().Unix()
+		log.Info("backfill job cancelled")
+	default:
+		job.Status = StatusFailed
+		// the cause can hold upstream urls, it is only logged
+		job.Error = ex.Code + ": " + ex.Message
+		job.Finished = time.Now().UTC().Unix()
+		log.Error("backfill job failed", logger.F("error", ex))
+	}
+	job.cancel()
+	job.cancel = nil
+	save()
+}
@@ -1,11 +1,17 @@
 package binance
 
 import (
+	"context"
+	"fmt"
 	"github.com/adshao/go-binance/v2"
 	"github.com/adshao/go-binance/v2/futures"
 	"github.com/godoji/candlestick"
-	"log"
-	"os"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"marlin/internal/gaps"
+	"marlin/internal/logger"
+	"marlin/internal/tracing"
+	"net/http"
 	"strconv"
 	"time"
 )
@@ -13,27 +19,47 @@ import (
 var futuresClient = futures.NewClient("", "")
 var spotClient = binance.NewClient("", "")
 
+// Configure routes all Binance calls through client, empty base urls keep the defaults
+func Configure(client *http.Client, spotURL string, futuresURL string) {
+	spotClient.HTTPClient = client
+	futuresClient.HTTPClient = client
+	if spotURL != "" {
+		spotClient.BaseURL = spotURL
+	}
+	if futuresURL != "" {
+		futuresClient.BaseURL = futuresURL
+	}
+}
+
 const fetchLimit = 1000
 
-func klineToCandle(o string, h string, l string, c string, v string, tn int64, tv string, t int64) candlestick.Candle {
-	candleOpen, _ := strconv.ParseFloat(o, 64)
-	candleHigh, _ := strconv.ParseFloat(h, 64)
-	candleLow, _ := strconv.ParseFloat(l, 64)
-	candleClose, _ := strconv.ParseFloat(c, 64)
-	candleVolume, _ := strconv.ParseFloat(v, 64)
-	candleNumberTrades := tn
-	candleTakerVolume, _ := strconv.ParseFloat(tv, 64)
-	candleTime := t
-	return candlestick.Candle{
-		Open:           candleOpen,
-		High:           candleHigh,
-		Low:            candleLow,
-		Close:          candleClose,
-		Volume:         candleVolume,
-		NumberOfTrades: candleNumberTrades,
-		TakerVolume:    candleTakerVolume,
-		Time:           candleTime,
+// BlockSize is the number of candles returned by FetchCandles
+const BlockSize = fetchLimit
+
+// LatestSize is the maximum number of candles returned by FetchLatest
+const LatestSize = latestLimit
+
+const latestLimit = 99
+
+func klineToCandle(o string, h string, l string, c string, v string, tn int64, tv string, t int64) (candlestick.Candle, error) {
+	values := make([]float64, 6)
+	for i, raw := range []string{o, h, l, c, v, tv} {
+		value, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return candlestick.Candle{}, fmt.Errorf("invalid kline at %d: %w", t, err)
+		}
+		values[i] = value
 	}
+	return candlestick.Candle{
+		Open:           values[0],
+		High:           values[1],
+		Low:            values[2],
+		Close:          values[3],
+		Volume:         values[4],
+		NumberOfTrades: tn,
+		TakerVolume:    values[5],
+		Time:           t,
+	}, nil
 }
 
 func futureToSpot(candles []*futures.Kline) []*binance.Kline {
@@ -56,7 +82,21 @@ func futureToSpot(candles []*futures.Kline) []*binance.Kline {
 	return results
 }
 
-func fillMissingCandles(candles []*binance.Kline, from time.Time, symbol string) []binance.Kline {
+// fillMissingCandles places candles on a one minute grid starting at from, candles
+// missing after the listing at listed are filled in and recorded in the gap index
+func fillMissingCandles(ctx context.Context, candles []*binance.Kline, from time.Time, target candlestick.AssetIdentifier, listed int64) ([]binance.Kline, error) {
+
+	log := logger.Ctx(ctx).With(
+		logger.F("broker", "BINANCE"),
+		logger.F("exchange", target.Exchange),
+		logger.F("symbol", target.Symbol),
+		logger.F("from", from.Unix()),
+		logger.F("interval", candlestick.Interval1m),
+	)
+
+	if len(candles) > 0 && candles[0].OpenTime/1000 < from.Unix() {
+		return nil, fmt.Errorf("response is invalid, candles start at %d while %d was requested", candles[0].OpenTime/1000, from.Unix())
+	}
 
 	results := make([]binance.Kline, 1000)
 	i := 0
@@ -65,8 +105,15 @@ func fillMissingCandles(candles []*binance.Kline, from time.Time, symbol string)
 	lastOpen := from.UnixMilli() - time.Minute.Milliseconds()
 	for _, candle := range candles {
 
+		// duplicate or out of order candles would break the time grid
+		if candle.OpenTime <= lastOpen {
+			log.Warn("dropped out of order candle", logger.F("time", candle.OpenTime/1000), logger.F("previous", lastOpen/1000))
+			continue
+		}
+
 		// downtime candles
-		for candle.OpenTime-lastOpen != time.Minute.Milliseconds() {
+		gapStart, gapLength := lastOpen+time.Minute.Milliseconds(), int64(0)
+		for candle.OpenTime-lastOpen > time.Minute.Milliseconds() {
 
 			lastOpen += time.Minute.Milliseconds()
 
@@ -75,28 +122,18 @@ func fillMissingCandles(candles []*binance.Kline, from time.Time, symbol string)
 				CloseTime: lastOpen + 60000 - 1, // 1 minute in milliseconds
 			}
 			filled += 1
+			gapLength += 1
 			i++
 
 			if i == 1000 {
-
-				requestTimeStamp := from.Unix()
-				responseTimeStamp := candles[0].OpenTime / 1000
-
-				log.Printf("%s dropped candles @%d: %d filled \n", symbol, from.Unix()/60/5000, filled)
-
-				if responseTimeStamp < requestTimeStamp {
-					log.Println("response is invalid, candles start earlier than requested")
-					log.Printf("expected %d got %d instead\n", requestTimeStamp, responseTimeStamp)
-					os.Exit(1)
-				} else if responseTimeStamp > requestTimeStamp {
-					// first available candle is returned when requesting a timestamp before first available
-				} else {
-					// occurs when some candles are not available but the first candle is
-				}
-
-				return results
+				break
 			}
 		}
+		recordGap(target, gapStart/1000, gapLength, listed)
+		if i == 1000 {
+			log.Warn("dropped candles filled", logger.F("block", from.Unix()/60/5000), logger.F("filled", filled))
+			return results, nil
+		}
 
 		lastOpen = candle.OpenTime
 		results[i] = *candle
@@ -108,14 +145,41 @@ func fillMissingCandles(candles []*binance.Kline, from time.Time, symbol string)
 	}
 
 	// fill time in remaining candles if not enough candles were returned
+	gapStart, gapLength := lastOpen+time.Minute.Milliseconds(), int64(0)
 	for i != 1000 {
 		lastOpen += time.Minute.Milliseconds()
 		results[i] = binance.Kline{
 			OpenTime:  lastOpen,
 			CloseTime: lastOpen + 60000 - 1,
 		}
+		gapLength++
 		i++
 	}
+	recordGap(target, gapStart/1000, gapLength, listed)
 
-	return results
+	return results, nil
+}
+
+// recordGap records length filled one minute candles starting at start in the gap
+// index, candles before the listing or which have not closed yet are left out
+func recordGap(target candlestick.AssetIdentifier, start int64, length int64, listed int64) {
+	end := start + length*candlestick.Interval1m
+	if start < listed {
+		start += (listed - start + candlestick.Interval1m - 1) / candlestick.Interval1m * candlestick.Interval1m
+	}
+	if now := time.Now().UTC().Unix(); end > now-now%candlestick.Interval1m {
+		end = now - now%candlestick.Interval1m
+	}
+	if end > start {
+		gaps.Record(target, candlestick.Interval1m, start, (end-start)/candlestick.Interval1m)
+	}
+}
+
+func startKlinesSpan(ctx context.Context, exchange string, symbol string, from int64) (context.Context, trace.Span) {
+	return tracing.Start(ctx, "binance.klines",
+		attribute.String("broker", "BINANCE"),
+		attribute.String("exchange", exchange),
+		attribute.String("symbol", symbol),
+		attribute.Int64("from", from),
+	)
 }
@@ -0,0 +1,186 @@
+package binance
+
+import (
+	"context"
+	"github.com/adshao/go-binance/v2"
+	"github.com/godoji/candlestick"
+	"marlin/internal/fixture"
+	"marlin/internal/gaps"
+	"math"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	// symbol lists and fixtures are looked up relative to the repository root
+	if err := os.Chdir("../.."); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+// replay serves all Binance calls from the recorded fixtures
+func replay() {
+	Configure(&http.Client{Transport: &fixture.Transport{Dir: "./testdata/fixtures", Mode: fixture.ModeReplay}}, "", "")
+}
+
+// start of the block the tests fill, long closed so no gap is clipped to now
+const blockStart = int64(1699980000)
+
+// klines returns one minute klines at the given minutes of the test block
+func klines(minutes ...int64) []*binance.Kline {
+	result := make([]*binance.Kline, len(minutes))
+	for i, m := range minutes {
+		open := (blockStart + m*60) * 1000
+		result[i] = &binance.Kline{OpenTime: open, CloseTime: open + 59999, Open: "1", High: "1", Low: "1", Close: "1", Volume: "1"}
+	}
+	return result
+}
+
+// span returns the minutes in [from, to)
+func span(from int64, to int64) []int64 {
+	result := make([]int64, 0, to-from)
+	for m := from; m < to; m++ {
+		result = append(result, m)
+	}
+	return result
+}
+
+func without(minutes []int64, from int64, to int64) []int64 {
+	result := make([]int64, 0, len(minutes))
+	for _, m := range minutes {
+		if m < from || m >= to {
+			result = append(result, m)
+		}
+	}
+	return result
+}
+
+func TestFillMissingCandles(t *testing.T) {
+	tests := []struct {
+		name    string
+		candles []*binance.Kline
+		listed  int64
+		filled  []int64 // minutes expected to be filled in
+		gaps    [][2]int64
+		invalid bool
+	}{
+		{
+			name:    "complete",
+			candles: klines(span(0, 1000)...),
+			listed:  math.MinInt64,
+		},
+		{
+			name:    "hole",
+			candles: klines(without(span(0, 1000), 10, 15)...),
+			listed:  math.MinInt64,
+			filled:  span(10, 15),
+			gaps:    [][2]int64{{blockStart + 600, 5}},
+		},
+		{
+			name:    "leading after listing",
+			candles: klines(span(2, 1000)...),
+			listed:  math.MinInt64,
+			filled:  span(0, 2),
+			gaps:    [][2]int64{{blockStart, 2}},
+		},
+		{
+			name:    "leading before listing",
+			candles: klines(span(5, 1000)...),
+			listed:  blockStart + 5*60,
+			filled:  span(0, 5),
+		},
+		{
+			name:    "listed within leading gap",
+			candles: klines(span(5, 1000)...),
+			listed:  blockStart + 2*60 + 30,
+			filled:  span(0, 5),
+			gaps:    [][2]int64{{blockStart + 3*60, 2}},
+		},
+		{
+			name:    "trailing",
+			candles: klines(span(0, 990)...),
+			listed:  math.MinInt64,
+			filled:  span(990, 1000),
+			gaps:    [][2]int64{{blockStart + 990*60, 10}},
+		},
+		{
+			name:    "out of order",
+			candles: append(klines(span(0, 500)...), klines(append([]int64{499, 3}, span(500, 1000)...)...)...),
+			listed:  math.MinInt64,
+		},
+		{
+			name:    "before block",
+			candles: klines(append([]int64{-1}, span(0, 999)...)...),
+			listed:  math.MinInt64,
+			invalid: true,
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			target := candlestick.NewAssetIdentifier("BINANCE", "SPOT", "TEST"+string(rune('A'+i))+"USDT")
+			result, err := fillMissingCandles(context.Background(), test.candles, time.Unix(blockStart, 0), target, test.listed)
+			if test.invalid {
+				if err == nil {
+					t.Fatal("expected an error for candles before the block")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(result) != 1000 {
+				t.Fatalf("got %d candles, want 1000", len(result))
+			}
+			filled := make(map[int64]bool)
+			for _, m := range test.filled {
+				filled[m] = true
+			}
+			for m, k := range result {
+				if want := (blockStart + int64(m)*60) * 1000; k.OpenTime != want {
+					t.Fatalf("candle %d opens at %d, want %d", m, k.OpenTime, want)
+				}
+				if isFilled := k.Open == ""; isFilled != filled[int64(m)] {
+					t.Errorf("candle %d filled is %v, want %v", m, isFilled, filled[int64(m)])
+				}
+			}
+
+			recorded := gaps.Find(target, blockStart, blockStart+1000*60)
+			if len(recorded) != len(test.gaps) {
+				t.Fatalf("recorded %d gaps, want %d: %+v", len(recorded), len(test.gaps), recorded)
+			}
+			for j, g := range recorded {
+				if g.Start != test.gaps[j][0] || g.Length != test.gaps[j][1] || g.Interval != candlestick.Interval1m {
+					t.Errorf("gap %d is %d+%d, want %d+%d", j, g.Start, g.Length, test.gaps[j][0], test.gaps[j][1])
+				}
+			}
+		})
+	}
+}
+
+func TestFetchCandlesReplay(t *testing.T) {
+	replay()
+
+	// the recorded block holds the gap of the example scenario at 1700000000
+	target := candlestick.NewAssetIdentifier("BINANCE", "SPOT", "BTCUSDT")
+	candles, ex := FetchCandles(context.Background(), time.Unix(blockStart, 0), target, math.MinInt64)
+	if ex != nil {
+		t.Fatal(ex)
+	}
+	if len(candles) != BlockSize {
+		t.Fatalf("got %d candles, want %d", len(candles), BlockSize)
+	}
+	missing := 0
+	for _, c := range candles {
+		if c.Missing {
+			missing++
+		}
+	}
+	if missing != 60 {
+		t.Errorf("got %d missing candles, want 60", missing)
+	}
+}
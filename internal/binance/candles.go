@@ -5,30 +5,45 @@ import (
 	"github.com/adshao/go-binance/v2"
 	"github.com/adshao/go-binance/v2/futures"
 	"github.com/godoji/candlestick"
-	"log"
+	"marlin/internal/config"
+	"marlin/internal/logger"
 	"marlin/internal/throw"
+	"marlin/internal/tracing"
 	"time"
 )
 
-func FetchCandles(from time.Time, target candlestick.AssetIdentifier) ([]candlestick.Candle, throw.Exception) {
+// FetchCandles returns a block of one minute candles starting at from, listed is the
+// time of the first candle of target and gaps before it are not recorded
+func FetchCandles(ctx context.Context, from time.Time, target candlestick.AssetIdentifier, listed int64) ([]candlestick.Candle, throw.Exception) {
 	var err error
 	var candles []candlestick.Candle
 	switch target.Exchange {
 	case "PERP":
-		candles, err = fetchFuturesCandles(from, target.Symbol)
+		candles, err = fetchFuturesCandles(ctx, from, target.Symbol, listed)
 	case "SPOT":
-		candles, err = fetchSpotCandles(from, target.Symbol)
+		candles, err = fetchSpotCandles(ctx, from, target.Symbol, listed)
 	default:
 		return nil, throw.ErrInvalidExchange
 	}
 	if err != nil {
-		log.Printf("failed fetching block %s at %s: %s\n", target.Symbol, from.UTC().Format(time.RFC3339), err.Error())
-		return nil, throw.New(err, throw.ErrKindUnexpected)
+		// the caller gave up, this is not an upstream failure
+		if ex := throw.FromContext(ctx); ex != nil {
+			return nil, ex.WithBroker(config.SourceBinance)
+		}
+		logger.Ctx(ctx).Error("failed fetching block",
+			logger.F("broker", target.Broker),
+			logger.F("exchange", target.Exchange),
+			logger.F("symbol", target.Symbol),
+			logger.F("from", from.Unix()),
+			logger.F("interval", candlestick.Interval1m),
+			logger.F("error", err),
+		)
+		return nil, throw.New(err, throw.ErrKindUnexpected).WithBroker(config.SourceBinance)
 	}
 	return candles, nil
 }
 
-func fetchFuturesCandles(from time.Time, symbol string) ([]candlestick.Candle, error) {
+func fetchFuturesCandles(ctx context.Context, from time.Time, symbol string, listed int64) ([]candlestick.Candle, error) {
 
 	// Fetch candles from Binance
 	var klines []*futures.Kline
@@ -36,7 +51,11 @@ func fetchFuturesCandles(from time.Time, symbol string) ([]candlestick.Candle, e
 	if from.Unix() > time.Now().UTC().Unix()+60*15 {
 		klines = make([]*futures.Kline, 0)
 	} else {
-		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		if err := limiter.wait(ctx, weightKlines); err != nil {
+			return nil, err
+		}
+		spanCtx, span := startKlinesSpan(ctx, "PERP", symbol, from.Unix())
+		reqCtx, cancel := context.WithTimeout(spanCtx, time.Second*5)
 		historyService := futuresClient.NewKlinesService()
 		var err error
 		klines, err = historyService.
@@ -44,8 +63,9 @@ func fetchFuturesCandles(from time.Time, symbol string) ([]candlestick.Candle, e
 			Symbol(symbol).
 			Limit(fetchLimit).
 			StartTime(from.UnixMilli()).
-			Do(ctx)
+			Do(reqCtx)
 		cancel()
+		tracing.End(span, err)
 
 		// Forward error if any
 		if err != nil {
@@ -53,11 +73,21 @@ func fetchFuturesCandles(from time.Time, symbol string) ([]candlestick.Candle, e
 		}
 	}
 
-	filtered := fillMissingCandles(futureToSpot(klines), from, symbol)
+	filtered, err := fillMissingCandles(ctx, futureToSpot(klines), from, candlestick.NewAssetIdentifier(config.SourceBinance, "PERP", symbol), listed)
+	if err != nil {
+		return nil, err
+	}
 
 	candles := make([]candlestick.Candle, 1000)
 	for i, k := range filtered {
-		candles[i] = klineToCandle(
+
+		// filled in candles carry no prices
+		if k.Open == "" {
+			candles[i] = candlestick.Candle{Time: k.OpenTime / 1000, Missing: true}
+			continue
+		}
+
+		candles[i], err = klineToCandle(
 			k.Open,
 			k.High,
 			k.Low,
@@ -67,6 +97,9 @@ func fetchFuturesCandles(from time.Time, symbol string) ([]candlestick.Candle, e
 			k.TakerBuyQuoteAssetVolume,
 			k.OpenTime/1000,
 		)
+		if err != nil {
+			return nil, err
+		}
 		c := candles[i]
 		if c.Open == 0 && c.High == 0 && c.Low == 0 && c.Close == 0 {
 			candles[i].Missing = true
@@ -76,7 +109,7 @@ func fetchFuturesCandles(from time.Time, symbol string) ([]candlestick.Candle, e
 	return candles, nil
 }
 
-func fetchSpotCandles(from time.Time, symbol string) ([]candlestick.Candle, error) {
+func fetchSpotCandles(ctx context.Context, from time.Time, symbol string, listed int64) ([]candlestick.Candle, error) {
 
 	// Fetch candles from Binance
 	var klines []*binance.Kline
@@ -84,7 +117,11 @@ func fetchSpotCandles(from time.Time, symbol string) ([]candlestick.Candle, erro
 	if from.Unix() > time.Now().UTC().Unix()+60*15 {
 		klines = make([]*binance.Kline, 0)
 	} else {
-		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		if err := limiter.wait(ctx, weightKlines); err != nil {
+			return nil, err
+		}
+		spanCtx, span := startKlinesSpan(ctx, "SPOT", symbol, from.Unix())
+		reqCtx, cancel := context.WithTimeout(spanCtx, time.Second*5)
 		historyService := spotClient.NewKlinesService()
 		var err error
 		klines, err = historyService.
@@ -92,8 +129,9 @@ func fetchSpotCandles(from time.Time, symbol string) ([]candlestick.Candle, erro
 			Symbol(symbol).
 			Limit(fetchLimit).
 			StartTime(from.UnixMilli()).
-			Do(ctx)
+			Do(reqCtx)
 		cancel()
+		tracing.End(span, err)
 
 		// Forward error if any
 		if err != nil {
@@ -101,11 +139,21 @@ func fetchSpotCandles(from time.Time, symbol string) ([]candlestick.Candle, erro
 		}
 	}
 
-	filtered := fillMissingCandles(klines, from, symbol)
+	filtered, err := fillMissingCandles(ctx, klines, from, candlestick.NewAssetIdentifier(config.SourceBinance, "SPOT", symbol), listed)
+	if err != nil {
+		return nil, err
+	}
 
 	candles := make([]candlestick.Candle, 1000)
 	for i, k := range filtered {
-		candles[i] = klineToCandle(
+
+		// filled in candles carry no prices
+		if k.Open == "" {
+			candles[i] = candlestick.Candle{Time: k.OpenTime / 1000, Missing: true}
+			continue
+		}
+
+		candles[i], err = klineToCandle(
 			k.Open,
 			k.High,
 			k.Low,
@@ -115,6 +163,9 @@ func fetchSpotCandles(from time.Time, symbol string) ([]candlestick.Candle, erro
 			k.TakerBuyQuoteAssetVolume,
 			k.OpenTime/1000,
 		)
+		if err != nil {
+			return nil, err
+		}
 		c := candles[i]
 		if c.Open == 0 && c.High == 0 && c.Low == 0 && c.Close == 0 {
 			candles[i].Missing = true
@@ -123,3 +174,59 @@ func fetchSpotCandles(from time.Time, symbol string) ([]candlestick.Candle, erro
 
 	return candles, nil
 }
+
+// FetchDailyCandles returns the daily candles of a spot symbol from its listing until
+// now, days without a kline are left out
+func FetchDailyCandles(ctx context.Context, symbol string) ([]candlestick.Candle, throw.Exception) {
+	candles, err := fetchDailyCandles(ctx, symbol)
+	if err != nil {
+		if ex := throw.FromContext(ctx); ex != nil {
+			return nil, ex.WithBroker(config.SourceBinance)
+		}
+		logger.Ctx(ctx).Error("failed fetching daily candles",
+			logger.F("broker", config.SourceBinance),
+			logger.F("exchange", "SPOT"),
+			logger.F("symbol", symbol),
+			logger.F("interval", candlestick.Interval1d),
+			logger.F("error", err),
+		)
+		return nil, throw.New(err, throw.ErrKindUnexpected).WithBroker(config.SourceBinance)
+	}
+	return candles, nil
+}
+
+func fetchDailyCandles(ctx context.Context, symbol string) ([]candlestick.Candle, error) {
+	candles := make([]candlestick.Candle, 0)
+	now := time.Now().UTC().Unix()
+	for from := int64(0); from <= now; {
+		if err := limiter.wait(ctx, weightKlines); err != nil {
+			return nil, err
+		}
+		spanCtx, span := startKlinesSpan(ctx, "SPOT", symbol, from)
+		reqCtx, cancel := context.WithTimeout(spanCtx, time.Second*5)
+		klines, err := spotClient.NewKlinesService().
+			Interval("1d").
+			Symbol(symbol).
+			Limit(fetchLimit).
+			StartTime(from * 1000).
+			Do(reqCtx)
+		cancel()
+		tracing.End(span, err)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, k := range klines {
+			c, err := klineToCandle(k.Open, k.High, k.Low, k.Close, k.Volume, k.TradeNum, k.TakerBuyQuoteAssetVolume, k.OpenTime/1000)
+			if err != nil {
+				return nil, err
+			}
+			candles = append(candles, c)
+		}
+		if len(klines) < fetchLimit {
+			break
+		}
+		from = klines[len(klines)-1].OpenTime/1000 + candlestick.Interval1d
+	}
+	return candles, nil
+}
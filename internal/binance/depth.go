@@ -0,0 +1,375 @@
+package binance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/adshao/go-binance/v2"
+	"github.com/adshao/go-binance/v2/common"
+	"github.com/adshao/go-binance/v2/futures"
+	"github.com/godoji/candlestick"
+	"go.opentelemetry.io/otel/attribute"
+	"marlin/internal/config"
+	"marlin/internal/depth"
+	"marlin/internal/logger"
+	"marlin/internal/throw"
+	"marlin/internal/tracing"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// depth request weights by limit as documented by Binance, futures weigh less
+func depthWeight(exchange string, limit int) int {
+	if exchange == "PERP" {
+		switch {
+		case limit <= 50:
+			return 2
+		case limit <= 100:
+			return 5
+		case limit <= 500:
+			return 10
+		default:
+			return 20
+		}
+	}
+	switch {
+	case limit <= 100:
+		return 5
+	case limit <= 500:
+		return 25
+	case limit <= 1000:
+		return 50
+	default:
+		return 250
+	}
+}
+
+// validDepthLimit reports whether exchange accepts limit, futures only serve a few
+// fixed book sizes while spot takes anything up to 5000
+func validDepthLimit(exchange string, limit int) bool {
+	if exchange == "PERP" {
+		switch limit {
+		case 5, 10, 20, 50, 100, 500, 1000:
+			return true
+		}
+		return false
+	}
+	return limit >= 1 && limit <= 5000
+}
+
+// levels of the REST snapshot a local book starts from
+const recordSnapshotLimit = 1000
+
+func toLevels(priceLevels []common.PriceLevel) ([]depth.Level, error) {
+	result := make([]depth.Level, len(priceLevels))
+	for i, l := range priceLevels {
+		price, err := strconv.ParseFloat(l.Price, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid depth price: %w", err)
+		}
+		quantity, err := strconv.ParseFloat(l.Quantity, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid depth quantity: %w", err)
+		}
+		result[i] = depth.Level{Price: price, Quantity: quantity}
+	}
+	return result, nil
+}
+
+// fetchDepthSnapshot requests a snapshot, the caller waits for its weight
+func fetchDepthSnapshot(ctx context.Context, exchange string, symbol string, limit int) (s *depth.Snapshot, err error) {
+	ctx, span := tracing.Start(ctx, "binance.depth",
+		attribute.String("exchange", exchange),
+		attribute.String("symbol", symbol),
+		attribute.Int("limit", limit),
+	)
+	defer func() { tracing.End(span, err) }()
+	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+
+	var bids, asks []common.PriceLevel
+	s = &depth.Snapshot{Symbol: symbol, Time: time.Now().UnixMilli()}
+	switch exchange {
+	case "PERP":
+		resp, err := futuresClient.NewDepthService().Symbol(symbol).Limit(limit).Do(ctx)
+		if err != nil {
+			return nil, err
+		}
+		s.LastUpdateId, s.Time, bids, asks = resp.LastUpdateID, resp.Time, resp.Bids, resp.Asks
+	case "SPOT":
+		resp, err := spotClient.NewDepthService().Symbol(symbol).Limit(limit).Do(ctx)
+		if err != nil {
+			return nil, err
+		}
+		s.LastUpdateId, bids, asks = resp.LastUpdateID, resp.Bids, resp.Asks
+	default:
+		return nil, fmt.Errorf("unknown exchange %s", exchange)
+	}
+
+	if s.Bids, err = toLevels(bids); err != nil {
+		return nil, err
+	}
+	if s.Asks, err = toLevels(asks); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// FetchDepth returns a REST order book snapshot with up to limit levels per side
+func FetchDepth(ctx context.Context, target candlestick.AssetIdentifier, limit int) (*depth.Snapshot, throw.Exception) {
+	if target.Exchange != "SPOT" && target.Exchange != "PERP" {
+		return nil, throw.ErrInvalidExchange
+	}
+	if !validDepthLimit(target.Exchange, limit) {
+		if target.Exchange == "PERP" {
+			return nil, throw.ErrInvalidFuturesDepthLimit
+		}
+		return nil, throw.ErrInvalidLimit
+	}
+	err := limiter.wait(ctx, depthWeight(target.Exchange, limit))
+	var s *depth.Snapshot
+	if err == nil {
+		s, err = fetchDepthSnapshot(ctx, target.Exchange, target.Symbol, limit)
+	}
+	if err != nil {
+		if ex := throw.FromContext(ctx); ex != nil {
+			return nil, ex.WithBroker(config.SourceBinance)
+		}
+		logger.Ctx(ctx).Error("failed fetching depth",
+			logger.F("exchange", target.Exchange),
+			logger.F("symbol", target.Symbol),
+			logger.F("error", err),
+		)
+		return nil, throw.New(err, throw.ErrKindUnexpected).WithBroker(config.SourceBinance)
+	}
+	return s, nil
+}
+
+// diffEvent is a diff-depth stream update of either market
+type diffEvent struct {
+	time     int64
+	first    int64
+	last     int64
+	previous int64
+	bids     []common.PriceLevel
+	asks     []common.PriceLevel
+}
+
+var errStreamBehind = errors.New("depth stream fell behind")
+
+// streams a single combined connection may carry, as documented by Binance
+func streamsPerConnection(exchange string) int {
+	if exchange == "PERP" {
+		return 200
+	}
+	return 1024
+}
+
+// symbolFeed buffers the events of one symbol of a combined stream, events are
+// dropped and reported on behind once its book falls behind
+type symbolFeed struct {
+	events chan diffEvent
+	behind chan struct{}
+}
+
+func newSymbolFeed() *symbolFeed {
+	return &symbolFeed{events: make(chan diffEvent, 1000), behind: make(chan struct{}, 1)}
+}
+
+func (f *symbolFeed) send(ev diffEvent) {
+	select {
+	case f.events <- ev:
+	default:
+		select {
+		case f.behind <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// drain drops all buffered events and a pending behind report
+func (f *symbolFeed) drain() {
+	for {
+		select {
+		case <-f.events:
+		case <-f.behind:
+		default:
+			return
+		}
+	}
+}
+
+// streamDepth subscribes to the combined diff-depth stream of all symbols in feeds and
+// hands every event to the feed of its symbol
+func streamDepth(exchange string, feeds map[string]*symbolFeed, errC chan<- error) (doneC chan struct{}, stopC chan struct{}, err error) {
+	symbols := make([]string, 0, len(feeds))
+	for symbol := range feeds {
+		symbols = append(symbols, symbol)
+	}
+	dispatch := func(symbol string, ev diffEvent) {
+		if feed, ok := feeds[symbol]; ok {
+			feed.send(ev)
+		}
+	}
+	onError := func(err error) {
+		select {
+		case errC <- err:
+		default:
+		}
+	}
+
+	if exchange == "PERP" {
+		return futures.WsCombinedDiffDepthServe(symbols, func(e *futures.WsDepthEvent) {
+			dispatch(e.Symbol, diffEvent{time: e.Time, first: e.FirstUpdateID, last: e.LastUpdateID, previous: e.PrevLastUpdateID, bids: e.Bids, asks: e.Asks})
+		}, onError)
+	}
+	return binance.WsCombinedDepthServe(symbols, func(e *binance.WsDepthEvent) {
+		dispatch(e.Symbol, diffEvent{time: e.Time, first: e.FirstUpdateID, last: e.LastUpdateID, bids: e.Bids, asks: e.Asks})
+	}, onError)
+}
+
+// RecordDepth keeps local order books of symbols from combined diff-depth streams and
+// passes a snapshot of the best levels of each to save every interval until ctx is
+// done. Books are rebuilt one by one from a fresh REST snapshot whenever updates were
+// missed, snapshots are paid from the recorder's own weight budget.
+func RecordDepth(ctx context.Context, exchange string, symbols []string, every time.Duration, levels int, save func(symbol string, s *depth.Snapshot)) {
+	wg := sync.WaitGroup{}
+	size := streamsPerConnection(exchange)
+	for start := 0; start < len(symbols); start += size {
+		end := start + size
+		if end > len(symbols) {
+			end = len(symbols)
+		}
+		chunk := symbols[start:end]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			recordStream(ctx, exchange, chunk, every, levels, save)
+		}()
+	}
+	wg.Wait()
+}
+
+// recordStream follows a single combined connection, reconnecting when it fails
+func recordStream(ctx context.Context, exchange string, symbols []string, every time.Duration, levels int, save func(symbol string, s *depth.Snapshot)) {
+	log := logger.With(logger.F("exchange", exchange), logger.F("symbols", len(symbols)))
+	for ctx.Err() == nil {
+		err := followStream(ctx, exchange, symbols, every, levels, save)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Warn("depth stream reconnecting", logger.F("error", err))
+		select {
+		case <-ctx.Done():
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
+func followStream(ctx context.Context, exchange string, symbols []string, every time.Duration, levels int, save func(symbol string, s *depth.Snapshot)) error {
+	feeds := make(map[string]*symbolFeed, len(symbols))
+	for _, symbol := range symbols {
+		feeds[symbol] = newSymbolFeed()
+	}
+	errC := make(chan error, 1)
+	doneC, stopC, err := streamDepth(exchange, feeds, errC)
+	if err != nil {
+		return err
+	}
+	defer close(stopC)
+
+	bookCtx, cancel := context.WithCancel(ctx)
+	wg := sync.WaitGroup{}
+	for symbol, feed := range feeds {
+		symbol, feed := symbol, feed
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			followBook(bookCtx, exchange, symbol, feed, every, levels, save)
+		}()
+	}
+
+	select {
+	case <-ctx.Done():
+		err = nil
+	case err = <-errC:
+	case <-doneC:
+		err = errors.New("depth stream closed")
+	}
+	cancel()
+	wg.Wait()
+	return err
+}
+
+// followBook maintains the book of symbol until ctx is done, resyncing it on its own
+// while the stream stays connected
+func followBook(ctx context.Context, exchange string, symbol string, feed *symbolFeed, every time.Duration, levels int, save func(symbol string, s *depth.Snapshot)) {
+	log := logger.With(logger.F("exchange", exchange), logger.F("symbol", symbol))
+	for ctx.Err() == nil {
+		err := maintainBook(ctx, exchange, symbol, feed, every, levels, save)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Warn("depth recorder resyncing", logger.F("error", err))
+		select {
+		case <-ctx.Done():
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
+func maintainBook(ctx context.Context, exchange string, symbol string, feed *symbolFeed, every time.Duration, levels int, save func(symbol string, s *depth.Snapshot)) error {
+
+	// the weight is reserved before stale events are dropped, so only the events sent
+	// while the snapshot is fetched are buffered
+	if err := recordLimiter.wait(ctx, depthWeight(exchange, recordSnapshotLimit)); err != nil {
+		return err
+	}
+	feed.drain()
+	snapshot, err := fetchDepthSnapshot(ctx, exchange, symbol, recordSnapshotLimit)
+	if err != nil {
+		return err
+	}
+	book := depth.NewBook(snapshot)
+	synced := false
+
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-feed.behind:
+			return errStreamBehind
+		case <-ticker.C:
+			if synced {
+				save(symbol, book.Snapshot(levels))
+			}
+		case ev := <-feed.events:
+			last := book.LastUpdateId()
+			if ev.last <= last {
+				continue
+			}
+			switch {
+			case !synced && (ev.first > last+1 || ev.last < last+1):
+				return errors.New("depth snapshot does not line up with the stream")
+			case synced && exchange == "PERP" && ev.previous != last:
+				return errors.New("missed futures depth update")
+			case synced && exchange != "PERP" && ev.first != last+1:
+				return errors.New("missed spot depth update")
+			}
+			synced = true
+
+			bids, err := toLevels(ev.bids)
+			if err != nil {
+				return err
+			}
+			asks, err := toLevels(ev.asks)
+			if err != nil {
+				return err
+			}
+			book.Apply(ev.time, ev.last, bids, asks)
+		}
+	}
+}
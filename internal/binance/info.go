@@ -3,22 +3,43 @@ package binance
 import (
 	"context"
 	"errors"
+	"fmt"
 	"github.com/adshao/go-binance/v2"
 	"github.com/adshao/go-binance/v2/futures"
 	"github.com/godoji/candlestick"
-	"log"
+	"go.opentelemetry.io/otel/attribute"
 	"marlin/internal/config"
+	"marlin/internal/logger"
+	"marlin/internal/tracing"
 	"math"
 	"strconv"
 	"sync"
 	"time"
 )
 
-func isFutureSymbolValid(s futures.Symbol) bool {
-	cryptoPairs := config.SymbolList(config.SourceBinance)
-	if _, ok := cryptoPairs[s.BaseAsset]; !ok {
-		return false
+// filterValue reads a numeric field of a symbol filter, Binance sends most of them as
+// strings
+func filterValue(symbol string, filter map[string]interface{}, key string) (float64, error) {
+	switch value := filter[key].(type) {
+	case string:
+		result, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return 0, fmt.Errorf("could not parse %s of %v filter of %s: %w", key, filter["filterType"], symbol, err)
+		}
+		return result, nil
+	case float64:
+		return value, nil
+	default:
+		return 0, fmt.Errorf("%s of %v filter of %s is missing", key, filter["filterType"], symbol)
 	}
+}
+
+func isWhitelisted(baseAsset string) bool {
+	_, ok := config.SymbolList(config.SourceBinance)[baseAsset]
+	return ok
+}
+
+func isFutureSymbolTradable(s futures.Symbol) bool {
 	if s.QuoteAsset != "USDT" {
 		return false
 	}
@@ -31,11 +52,11 @@ func isFutureSymbolValid(s futures.Symbol) bool {
 	return true
 }
 
-func isSpotSymbolValid(s binance.Symbol) bool {
-	cryptoPairs := config.SymbolList(config.SourceBinance)
-	if _, ok := cryptoPairs[s.BaseAsset]; !ok {
-		return false
-	}
+func isFutureSymbolValid(s futures.Symbol) bool {
+	return isWhitelisted(s.BaseAsset) && isFutureSymbolTradable(s)
+}
+
+func isSpotSymbolTradable(s binance.Symbol) bool {
 	if !s.IsSpotTradingAllowed {
 		return false
 	}
@@ -51,29 +72,68 @@ func isSpotSymbolValid(s binance.Symbol) bool {
 	return true
 }
 
-func fetchFuturesExchangeInfo() *futures.ExchangeInfo {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+func isSpotSymbolValid(s binance.Symbol) bool {
+	return isWhitelisted(s.BaseAsset) && isSpotSymbolTradable(s)
+}
+
+// TradableAssets returns the base assets with a market on exchange which marlin
+// could serve, regardless of the whitelist
+func TradableAssets(ctx context.Context, exchange string) (map[string]bool, error) {
+	result := make(map[string]bool)
+	switch exchange {
+	case "PERP":
+		info, err := fetchFuturesExchangeInfo(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range info.Symbols {
+			if isFutureSymbolTradable(s) {
+				result[s.BaseAsset] = true
+			}
+		}
+	case "SPOT":
+		info, err := fetchSpotExchangeInfo(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range info.Symbols {
+			if isSpotSymbolTradable(s) {
+				result[s.BaseAsset] = true
+			}
+		}
+	default:
+		return nil, errors.New("unknown exchange " + exchange)
+	}
+	return result, nil
+}
+
+func fetchFuturesExchangeInfo(ctx context.Context) (*futures.ExchangeInfo, error) {
+	if err := limiter.wait(ctx, weightExchangeInfo); err != nil {
+		return nil, err
+	}
+	ctx, span := tracing.Start(ctx, "binance.exchangeInfo", attribute.String("exchange", "PERP"))
+	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
 	info, err := futuresClient.NewExchangeInfoService().Do(ctx)
 	cancel()
-	if err != nil {
-		log.Fatal(err)
-	}
-	return info
+	tracing.End(span, err)
+	return info, err
 }
 
-func fetchSpotExchangeInfo() *binance.ExchangeInfo {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+func fetchSpotExchangeInfo(ctx context.Context) (*binance.ExchangeInfo, error) {
+	if err := limiter.wait(ctx, weightExchangeInfo); err != nil {
+		return nil, err
+	}
+	ctx, span := tracing.Start(ctx, "binance.exchangeInfo", attribute.String("exchange", "SPOT"))
+	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
 	info, err := spotClient.NewExchangeInfoService().Do(ctx)
 	cancel()
-	if err != nil {
-		log.Fatal(err)
-	}
-	return info
+	tracing.End(span, err)
+	return info, err
 }
 
-func GetFuturesInfo() *candlestick.ExchangeInfo {
+func GetFuturesInfo(ctx context.Context) (*candlestick.ExchangeInfo, error) {
 
-	log.Println("fetch binance futures exchange info")
+	logger.Ctx(ctx).Info("fetch exchange info", logger.F("broker", "BINANCE"), logger.F("exchange", "PERP"))
 
 	result := &candlestick.ExchangeInfo{
 		Name:       "Futures Trading",
@@ -83,9 +143,13 @@ func GetFuturesInfo() *candlestick.ExchangeInfo {
 		Symbols:    make(map[string]*candlestick.AssetInfo),
 		Resolution: []int64{candlestick.Interval1m},
 	}
-	info := fetchFuturesExchangeInfo()
+	info, err := fetchFuturesExchangeInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
 	onBoardDateMap := make(map[string]int64)
 	onBoardLock := sync.Mutex{}
+	var onBoardErr error
 	count := 0
 
 	var wg sync.WaitGroup
@@ -99,20 +163,25 @@ func GetFuturesInfo() *candlestick.ExchangeInfo {
 		sem <- struct{}{}
 		go func(symbol string) {
 			defer wg.Done()
-			onBoard, err := getFuturesOnBoardDate(symbol)
+			defer func() { <-sem }()
+			onBoard, err := getFuturesOnBoardDate(ctx, symbol)
+			onBoardLock.Lock()
+			defer onBoardLock.Unlock()
 			if err != nil {
-				log.Fatal(err)
+				if onBoardErr == nil {
+					onBoardErr = err
+				}
+				return
 			}
-			onBoardLock.Lock()
 			onBoardDateMap[symbol] = onBoard
-			onBoardLock.Unlock()
-			<-sem
 		}(s.Symbol)
 	}
 
 	wg.Wait()
+	if onBoardErr != nil {
+		return nil, onBoardErr
+	}
 
-	var err error
 	for _, s := range info.Symbols {
 		if !isFutureSymbolValid(s) {
 			continue
@@ -129,37 +198,34 @@ func GetFuturesInfo() *candlestick.ExchangeInfo {
 		for _, filter := range s.Filters {
 			switch filter["filterType"] {
 			case "PRICE_FILTER":
-				maxPrice, err = strconv.ParseFloat(filter["maxPrice"].(string), 64)
-				if err != nil {
-					log.Fatal(err)
+				if maxPrice, err = filterValue(s.Symbol, filter, "maxPrice"); err != nil {
+					return nil, err
 				}
-				minPrice, err = strconv.ParseFloat(filter["minPrice"].(string), 64)
-				if err != nil {
-					log.Fatal(err)
+				if minPrice, err = filterValue(s.Symbol, filter, "minPrice"); err != nil {
+					return nil, err
 				}
-				tickSize, err = strconv.ParseFloat(filter["tickSize"].(string), 64)
-				if err != nil {
-					log.Fatal(err)
+				if tickSize, err = filterValue(s.Symbol, filter, "tickSize"); err != nil {
+					return nil, err
 				}
 			case "MARKET_LOT_SIZE":
-				maxQuantity, err = strconv.ParseFloat(filter["maxQty"].(string), 64)
-				if err != nil {
-					log.Fatal(err)
+				if maxQuantity, err = filterValue(s.Symbol, filter, "maxQty"); err != nil {
+					return nil, err
 				}
-				minQuantity, err = strconv.ParseFloat(filter["minQty"].(string), 64)
-				if err != nil {
-					log.Fatal(err)
+				if minQuantity, err = filterValue(s.Symbol, filter, "minQty"); err != nil {
+					return nil, err
 				}
-				stepSize, err = strconv.ParseFloat(filter["stepSize"].(string), 64)
-				if err != nil {
-					log.Fatal(err)
+				if stepSize, err = filterValue(s.Symbol, filter, "stepSize"); err != nil {
+					return nil, err
 				}
 			case "MAX_NUM_ORDERS":
-				maxNumOrders = int(filter["limit"].(float64))
-			case "MIN_NOTIONAL":
-				minNotional, err = strconv.ParseFloat(filter["notional"].(string), 64)
+				limit, err := filterValue(s.Symbol, filter, "limit")
 				if err != nil {
-					log.Fatal(err)
+					return nil, err
+				}
+				maxNumOrders = int(limit)
+			case "MIN_NOTIONAL":
+				if minNotional, err = filterValue(s.Symbol, filter, "notional"); err != nil {
+					return nil, err
 				}
 			}
 		}
@@ -192,12 +258,12 @@ func GetFuturesInfo() *candlestick.ExchangeInfo {
 
 	}
 
-	return result
+	return result, nil
 }
 
-func GetSpotInfo() *candlestick.ExchangeInfo {
+func GetSpotInfo(ctx context.Context) (*candlestick.ExchangeInfo, error) {
 
-	log.Println("fetch binance spot exchange info")
+	logger.Ctx(ctx).Info("fetch exchange info", logger.F("broker", "BINANCE"), logger.F("exchange", "SPOT"))
 
 	result := &candlestick.ExchangeInfo{
 		Name:       "Spot Trading",
@@ -207,9 +273,13 @@ func GetSpotInfo() *candlestick.ExchangeInfo {
 		Symbols:    make(map[string]*candlestick.AssetInfo),
 		Resolution: []int64{candlestick.Interval1m},
 	}
-	info := fetchSpotExchangeInfo()
+	info, err := fetchSpotExchangeInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
 	onBoardDateMap := make(map[string]int64)
 	onBoardLock := sync.Mutex{}
+	var onBoardErr error
 	count := 0
 
 	var wg sync.WaitGroup
@@ -222,19 +292,24 @@ func GetSpotInfo() *candlestick.ExchangeInfo {
 		sem <- struct{}{}
 		go func(symbol string) {
 			defer wg.Done()
-			onBoard, err := getSpotOnBoardDate(symbol)
+			defer func() { <-sem }()
+			onBoard, err := getSpotOnBoardDate(ctx, symbol)
+			onBoardLock.Lock()
+			defer onBoardLock.Unlock()
 			if err != nil {
-				log.Fatal(err)
+				if onBoardErr == nil {
+					onBoardErr = err
+				}
+				return
 			}
-			onBoardLock.Lock()
 			onBoardDateMap[symbol] = onBoard
-			onBoardLock.Unlock()
-			<-sem
 		}(s.Symbol)
 	}
 	wg.Wait()
+	if onBoardErr != nil {
+		return nil, onBoardErr
+	}
 
-	var err error
 	for _, s := range info.Symbols {
 
 		if !isSpotSymbolValid(s) {
@@ -252,37 +327,34 @@ func GetSpotInfo() *candlestick.ExchangeInfo {
 		for _, filter := range s.Filters {
 			switch filter["filterType"] {
 			case "PRICE_FILTER":
-				maxPrice, err = strconv.ParseFloat(filter["maxPrice"].(string), 64)
-				if err != nil {
-					log.Fatal(err)
+				if maxPrice, err = filterValue(s.Symbol, filter, "maxPrice"); err != nil {
+					return nil, err
 				}
-				minPrice, err = strconv.ParseFloat(filter["minPrice"].(string), 64)
-				if err != nil {
-					log.Fatal(err)
+				if minPrice, err = filterValue(s.Symbol, filter, "minPrice"); err != nil {
+					return nil, err
 				}
-				tickSize, err = strconv.ParseFloat(filter["tickSize"].(string), 64)
-				if err != nil {
-					log.Fatal(err)
+				if tickSize, err = filterValue(s.Symbol, filter, "tickSize"); err != nil {
+					return nil, err
 				}
 			case "MARKET_LOT_SIZE":
-				maxQuantity, err = strconv.ParseFloat(filter["maxQty"].(string), 64)
-				if err != nil {
-					log.Fatal(err)
+				if maxQuantity, err = filterValue(s.Symbol, filter, "maxQty"); err != nil {
+					return nil, err
 				}
-				minQuantity, err = strconv.ParseFloat(filter["minQty"].(string), 64)
-				if err != nil {
-					log.Fatal(err)
+				if minQuantity, err = filterValue(s.Symbol, filter, "minQty"); err != nil {
+					return nil, err
 				}
-				stepSize, err = strconv.ParseFloat(filter["stepSize"].(string), 64)
-				if err != nil {
-					log.Fatal(err)
+				if stepSize, err = filterValue(s.Symbol, filter, "stepSize"); err != nil {
+					return nil, err
 				}
 			case "MAX_NUM_ORDERS":
-				maxNumOrders = int(filter["maxNumOrders"].(float64))
-			case "MIN_NOTIONAL":
-				minNotional, err = strconv.ParseFloat(filter["minNotional"].(string), 64)
+				limit, err := filterValue(s.Symbol, filter, "maxNumOrders")
 				if err != nil {
-					log.Fatal(err)
+					return nil, err
+				}
+				maxNumOrders = int(limit)
+			case "MIN_NOTIONAL":
+				if minNotional, err = filterValue(s.Symbol, filter, "minNotional"); err != nil {
+					return nil, err
 				}
 			}
 		}
@@ -315,11 +387,16 @@ func GetSpotInfo() *candlestick.ExchangeInfo {
 
 	}
 
-	return result
+	return result, nil
 }
 
-func getFuturesOnBoardDate(symbol string) (int64, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+func getFuturesOnBoardDate(ctx context.Context, symbol string) (int64, error) {
+	if err := limiter.wait(ctx, weightRecentKlines); err != nil {
+		return 0, err
+	}
+	ctx, span := startKlinesSpan(ctx, "PERP", symbol, 0)
+	defer span.End()
+	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
 	historyService := futuresClient.NewKlinesService()
 	klines, err := historyService.
 		Interval("1m").
@@ -332,14 +409,19 @@ func getFuturesOnBoardDate(symbol string) (int64, error) {
 		return 0, err
 	}
 	if len(klines) == 0 {
-		log.Printf("no candles returned when requesting first candle of %s\n", symbol)
+		logger.Ctx(ctx).Warn("no candles returned when requesting first candle", logger.F("broker", "BINANCE"), logger.F("symbol", symbol))
 		return 0, errors.New("no candles received")
 	}
 	return klines[0].OpenTime / 1000, nil
 }
 
-func getSpotOnBoardDate(symbol string) (int64, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+func getSpotOnBoardDate(ctx context.Context, symbol string) (int64, error) {
+	if err := limiter.wait(ctx, weightRecentKlines); err != nil {
+		return 0, err
+	}
+	ctx, span := startKlinesSpan(ctx, "SPOT", symbol, 0)
+	defer span.End()
+	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
 	historyService := spotClient.NewKlinesService()
 	klines, err := historyService.
 		Interval("1m").
@@ -352,7 +434,7 @@ func getSpotOnBoardDate(symbol string) (int64, error) {
 		return 0, err
 	}
 	if len(klines) == 0 {
-		log.Printf("no candles returned when requesting first candle of %s\n", symbol)
+		logger.Ctx(ctx).Warn("no candles returned when requesting first candle", logger.F("broker", "BINANCE"), logger.F("symbol", symbol))
 		return 0, errors.New("no candles received")
 	}
 	return klines[0].OpenTime / 1000, nil
@@ -0,0 +1,76 @@
+package binance
+
+import (
+	"context"
+	"github.com/godoji/candlestick"
+	"testing"
+)
+
+func TestExchangeInfoFilters(t *testing.T) {
+	replay()
+
+	tests := []struct {
+		name        string
+		fetch       func(ctx context.Context) (*candlestick.ExchangeInfo, error)
+		symbols     []string
+		onBoard     int64
+		constraints candlestick.TradeConstraints
+	}{
+		{
+			name:    "spot",
+			fetch:   GetSpotInfo,
+			symbols: []string{"BINANCE:SPOT:BTCUSDT"}, // LUNAUSDT is delisted and not whitelisted
+			onBoard: 1502942400,
+			constraints: candlestick.TradeConstraints{
+				MinPrice:     0.01,
+				MaxPrice:     1000000,
+				TickSize:     0.01,
+				MinQuantity:  0.001,
+				MaxQuantity:  1000,
+				StepSize:     0.001,
+				MaxNumOrders: 200,
+				MinNotional:  10,
+			},
+		},
+		{
+			name:    "futures",
+			fetch:   GetFuturesInfo,
+			symbols: []string{"BINANCE:PERP:BTCUSDT"},
+			onBoard: 1568102400,
+			constraints: candlestick.TradeConstraints{
+				MinPrice:     0.01,
+				MaxPrice:     1000000,
+				TickSize:     0.01,
+				MinQuantity:  0.001,
+				MaxQuantity:  1000,
+				StepSize:     0.001,
+				MaxNumOrders: 200,
+				MinNotional:  100,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			info, err := test.fetch(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(info.Symbols) != len(test.symbols) {
+				t.Fatalf("got %d symbols, want %d", len(info.Symbols), len(test.symbols))
+			}
+			for _, symbol := range test.symbols {
+				asset, ok := info.Symbols[symbol]
+				if !ok {
+					t.Fatalf("symbol %s is missing", symbol)
+				}
+				if asset.OnBoardDate != test.onBoard {
+					t.Errorf("%s listed at %d, want %d", symbol, asset.OnBoardDate, test.onBoard)
+				}
+				if asset.Constraints != test.constraints {
+					t.Errorf("%s constraints are %+v, want %+v", symbol, asset.Constraints, test.constraints)
+				}
+			}
+		})
+	}
+}
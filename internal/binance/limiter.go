@@ -0,0 +1,73 @@
+package binance
+
+import (
+	"context"
+	"marlin/internal/config"
+	"math"
+	"sync"
+	"time"
+)
+
+// request weights as documented by Binance
+const (
+	weightKlines        = 5 // klines with a limit of up to 1000
+	weightRecentKlines  = 1 // klines with a limit below 100
+	weightExchangeInfo  = 10
+	weightSpotTrades    = 2 // aggregated trades
+	weightFuturesTrades = 20
+)
+
+// weightLimiter keeps the request weight sent to Binance below the per minute budget,
+// every call waits for its weight instead of risking an IP ban
+type weightLimiter struct {
+	lock   sync.Mutex
+	tokens float64
+	last   time.Time
+	budget func() int
+}
+
+var limiter = &weightLimiter{tokens: -1, budget: func() int {
+	return config.ServiceConfig().BinanceWeight()
+}}
+
+// the depth recorder pays for its snapshots from a separate budget so resyncing books
+// never delays user requests
+var recordLimiter = &weightLimiter{tokens: -1, budget: func() int {
+	return config.ServiceConfig().DepthRecorder().Weight
+}}
+
+// wait blocks until weight is available or ctx is done
+func (l *weightLimiter) wait(ctx context.Context, weight int) error {
+	budget := float64(l.budget())
+	if budget <= 0 {
+		return nil
+	}
+	perSecond := budget / 60
+
+	for {
+		l.lock.Lock()
+		now := time.Now()
+		if l.tokens < 0 {
+			l.tokens = budget
+		} else {
+			l.tokens = math.Min(budget, l.tokens+now.Sub(l.last).Seconds()*perSecond)
+		}
+		l.last = now
+
+		if l.tokens >= float64(weight) {
+			l.tokens -= float64(weight)
+			l.lock.Unlock()
+			return nil
+		}
+		delay := time.Duration((float64(weight) - l.tokens) / perSecond * float64(time.Second))
+		l.lock.Unlock()
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
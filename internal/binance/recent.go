@@ -3,47 +3,62 @@ package binance
 import (
 	"context"
 	"github.com/godoji/candlestick"
-	"log"
+	"marlin/internal/config"
+	"marlin/internal/logger"
 	"marlin/internal/throw"
+	"marlin/internal/tracing"
 	"time"
 )
 
-func FetchLatest(from int64, target candlestick.AssetIdentifier) ([]candlestick.Candle, throw.Exception) {
+func FetchLatest(ctx context.Context, from int64, target candlestick.AssetIdentifier) ([]candlestick.Candle, throw.Exception) {
 
 	var err error
 	var candles []candlestick.Candle
 
 	switch target.Exchange {
 	case "PERP":
-		candles, err = fetchFuturesLatest(from, target.Symbol)
+		candles, err = fetchFuturesLatest(ctx, from, target.Symbol)
 	case "SPOT":
-		candles, err = fetchSpotLatest(from, target.Symbol)
+		candles, err = fetchSpotLatest(ctx, from, target.Symbol)
 	default:
-		log.Printf("invalid market type \"%s\"\n", target.Exchange)
+		logger.Ctx(ctx).Warn("invalid market type", logger.F("broker", target.Broker), logger.F("exchange", target.Exchange))
 		return nil, throw.ErrInvalidExchange
 	}
 
 	if err != nil {
-		ts := time.Unix(from, 0)
-		log.Printf("failed fetching %s (%s) from %s\n", target.Symbol, target.Exchange, ts.UTC().Format(time.RFC3339))
-		log.Println(err.Error())
-		return nil, throw.New(err, throw.ErrKindUnexpected)
+		// the caller gave up, this is not an upstream failure
+		if ex := throw.FromContext(ctx); ex != nil {
+			return nil, ex.WithBroker(config.SourceBinance)
+		}
+		logger.Ctx(ctx).Error("failed fetching latest candles",
+			logger.F("broker", target.Broker),
+			logger.F("exchange", target.Exchange),
+			logger.F("symbol", target.Symbol),
+			logger.F("from", from),
+			logger.F("error", err),
+		)
+		return nil, throw.New(err, throw.ErrKindUnexpected).WithBroker(config.SourceBinance)
 	}
 
 	return candles, nil
 }
 
-func fetchFuturesLatest(from int64, symbol string) ([]candlestick.Candle, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+func fetchFuturesLatest(ctx context.Context, from int64, symbol string) ([]candlestick.Candle, error) {
+	if err := limiter.wait(ctx, weightRecentKlines); err != nil {
+		return nil, err
+	}
+	spanCtx, span := startKlinesSpan(ctx, "PERP", symbol, from)
+	reqCtx, cancel := context.WithTimeout(spanCtx, time.Second*5)
 	historyService := futuresClient.NewKlinesService()
-	klines, err := historyService.Interval("1m").Symbol(symbol).Limit(99).StartTime(from * 1000).Do(ctx)
+	klines, err := historyService.Interval("1m").Symbol(symbol).Limit(latestLimit).StartTime(from * 1000).Do(reqCtx)
 	cancel()
+	tracing.End(span, err)
 	if err != nil {
 		return nil, err
 	}
 	candles := make([]candlestick.Candle, len(klines))
 	for i, k := range klines {
-		candles[i] = klineToCandle(
+		candles[i], err = klineToCandle(
 			k.Open,
 			k.High,
 			k.Low,
@@ -53,21 +68,29 @@ func fetchFuturesLatest(from int64, symbol string) ([]candlestick.Candle, error)
 			k.TakerBuyQuoteAssetVolume,
 			k.OpenTime/1000,
 		)
+		if err != nil {
+			return nil, err
+		}
 	}
 	return candles, nil
 }
 
-func fetchSpotLatest(from int64, symbol string) ([]candlestick.Candle, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+func fetchSpotLatest(ctx context.Context, from int64, symbol string) ([]candlestick.Candle, error) {
+	if err := limiter.wait(ctx, weightRecentKlines); err != nil {
+		return nil, err
+	}
+	spanCtx, span := startKlinesSpan(ctx, "SPOT", symbol, from)
+	reqCtx, cancel := context.WithTimeout(spanCtx, time.Second*5)
 	historyService := spotClient.NewKlinesService()
-	klines, err := historyService.Interval("1m").Symbol(symbol).Limit(99).StartTime(from * 1000).Do(ctx)
+	klines, err := historyService.Interval("1m").Symbol(symbol).Limit(latestLimit).StartTime(from * 1000).Do(reqCtx)
 	cancel()
+	tracing.End(span, err)
 	if err != nil {
 		return nil, err
 	}
 	candles := make([]candlestick.Candle, len(klines))
 	for i, k := range klines {
-		candles[i] = klineToCandle(
+		candles[i], err = klineToCandle(
 			k.Open,
 			k.High,
 			k.Low,
@@ -77,6 +100,9 @@ func fetchSpotLatest(from int64, symbol string) ([]candlestick.Candle, error) {
 			k.TakerBuyQuoteAssetVolume,
 			k.OpenTime/1000,
 		)
+		if err != nil {
+			return nil, err
+		}
 	}
 	return candles, nil
 }
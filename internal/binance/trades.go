@@ -0,0 +1,168 @@
+package binance
+
+import (
+	"context"
+	"fmt"
+	"github.com/godoji/candlestick"
+	"go.opentelemetry.io/otel/attribute"
+	"marlin/internal/config"
+	"marlin/internal/logger"
+	"marlin/internal/throw"
+	"marlin/internal/tracing"
+	"marlin/internal/trades"
+	"strconv"
+	"time"
+)
+
+// longest time range Binance accepts for aggregated trades in seconds
+const tradesWindow = 3600
+
+// at most this many empty time windows are walked by a single request
+const maxEmptyWindows = 24
+
+// FetchTrades returns up to limit aggregated trades before to, starting at trade
+// fromId or at from when fromId is negative. Time windows without trades are skipped
+// for at most a day, when that yields nothing the time to continue from is returned
+// instead, which is zero once there are no trades left before to.
+func FetchTrades(ctx context.Context, target candlestick.AssetIdentifier, fromId int64, from int64, to int64, limit int) ([]trades.Trade, int64, throw.Exception) {
+	if target.Exchange != "SPOT" && target.Exchange != "PERP" {
+		return nil, 0, throw.ErrInvalidExchange
+	}
+
+	result, next, err := fetchTrades(ctx, target.Exchange, target.Symbol, fromId, from, to, limit)
+	if err != nil {
+		if ex := throw.FromContext(ctx); ex != nil {
+			return nil, 0, ex.WithBroker(config.SourceBinance)
+		}
+		logger.Ctx(ctx).Error("failed fetching trades",
+			logger.F("exchange", target.Exchange),
+			logger.F("symbol", target.Symbol),
+			logger.F("fromId", fromId),
+			logger.F("from", from),
+			logger.F("error", err),
+		)
+		return nil, 0, throw.New(err, throw.ErrKindUnexpected).WithBroker(config.SourceBinance)
+	}
+	return result, next, nil
+}
+
+func fetchTrades(ctx context.Context, exchange string, symbol string, fromId int64, from int64, to int64, limit int) ([]trades.Trade, int64, error) {
+	if fromId >= 0 {
+		page, err := fetchTradesPage(ctx, exchange, symbol, fromId, 0, 0, limit)
+		if err != nil {
+			return nil, 0, err
+		}
+		return before(page, to), 0, nil
+	}
+
+	// time ranges are limited to an hour, walk them until one holds trades
+	cursor := from
+	for windows := 0; cursor < to && windows < maxEmptyWindows; windows++ {
+		end := cursor + tradesWindow
+		if end > to {
+			end = to
+		}
+		page, err := fetchTradesPage(ctx, exchange, symbol, -1, cursor, end, limit)
+		if err != nil {
+			return nil, 0, err
+		}
+		if len(page) > 0 {
+			return page, 0, nil
+		}
+		cursor = end
+	}
+	if cursor < to {
+		return []trades.Trade{}, cursor, nil
+	}
+	return []trades.Trade{}, 0, nil
+}
+
+// before drops the trades at or after to
+func before(page []trades.Trade, to int64) []trades.Trade {
+	for i, t := range page {
+		if t.Time >= to*1000 {
+			return page[:i]
+		}
+	}
+	return page
+}
+
+// fetchTradesPage requests a single page either from trade fromId or within [from, to)
+func fetchTradesPage(ctx context.Context, exchange string, symbol string, fromId int64, from int64, to int64, limit int) (result []trades.Trade, err error) {
+	weight := weightSpotTrades
+	if exchange == "PERP" {
+		weight = weightFuturesTrades
+	}
+	if err = limiter.wait(ctx, weight); err != nil {
+		return nil, err
+	}
+	ctx, span := tracing.Start(ctx, "binance.aggTrades",
+		attribute.String("exchange", exchange),
+		attribute.String("symbol", symbol),
+		attribute.Int64("fromId", fromId),
+		attribute.Int64("from", from),
+	)
+	defer func() { tracing.End(span, err) }()
+	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+
+	switch exchange {
+	case "PERP":
+		service := futuresClient.NewAggTradesService().Symbol(symbol).Limit(limit)
+		if fromId >= 0 {
+			service.FromID(fromId)
+		} else {
+			service.StartTime(from * 1000).EndTime(to*1000 - 1)
+		}
+		resp, err := service.Do(ctx)
+		if err != nil {
+			return nil, err
+		}
+		result = make([]trades.Trade, len(resp))
+		for i, t := range resp {
+			if result[i], err = toTrade(t.AggTradeID, t.Price, t.Quantity, t.FirstTradeID, t.LastTradeID, t.Timestamp, t.IsBuyerMaker); err != nil {
+				return nil, err
+			}
+		}
+	case "SPOT":
+		service := spotClient.NewAggTradesService().Symbol(symbol).Limit(limit)
+		if fromId >= 0 {
+			service.FromID(fromId)
+		} else {
+			service.StartTime(from * 1000).EndTime(to*1000 - 1)
+		}
+		resp, err := service.Do(ctx)
+		if err != nil {
+			return nil, err
+		}
+		result = make([]trades.Trade, len(resp))
+		for i, t := range resp {
+			if result[i], err = toTrade(t.AggTradeID, t.Price, t.Quantity, t.FirstTradeID, t.LastTradeID, t.Timestamp, t.IsBuyerMaker); err != nil {
+				return nil, err
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unknown exchange %s", exchange)
+	}
+	return result, nil
+}
+
+func toTrade(id int64, p string, q string, first int64, last int64, t int64, buyerMaker bool) (trades.Trade, error) {
+	price, err := strconv.ParseFloat(p, 64)
+	if err != nil {
+		return trades.Trade{}, fmt.Errorf("invalid trade price: %w", err)
+	}
+	quantity, err := strconv.ParseFloat(q, 64)
+	if err != nil {
+		return trades.Trade{}, fmt.Errorf("invalid trade quantity: %w", err)
+	}
+	return trades.Trade{
+		Id:           id,
+		Price:        price,
+		Quantity:     quantity,
+		FirstTradeId: first,
+		LastTradeId:  last,
+		Time:         t,
+		BuyerMaker:   buyerMaker,
+	}, nil
+}
@@ -0,0 +1,245 @@
+package coinbase
+
+import (
+	"context"
+	"fmt"
+	"github.com/godoji/candlestick"
+	"go.opentelemetry.io/otel/attribute"
+	"marlin/internal/config"
+	"marlin/internal/gaps"
+	"marlin/internal/logger"
+	"marlin/internal/throw"
+	"marlin/internal/tracing"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// BlockSize is the number of candles returned by FetchCandles, the same as for Binance
+const BlockSize = 1000
+
+// LatestSize is the maximum number of candles returned by FetchLatest
+const LatestSize = 99
+
+// Coinbase returns at most this many candles per request
+const pageLimit = 300
+
+const (
+	minute = int64(60)
+	hour   = 60 * minute
+	day    = 24 * hour
+)
+
+// longest run of minutes without a candle which is taken as a time without trades,
+// longer runs are outages
+const quietMinutes = 5
+
+// Coinbase publishes candles with a delay, until then minutes without a candle may
+// still get one
+const publishDelay = 2 * minute
+
+// FetchCandles returns a block of one minute candles starting at from, listed is the
+// time of the first candle of target
+func FetchCandles(ctx context.Context, from time.Time, target candlestick.AssetIdentifier, listed int64) ([]candlestick.Candle, throw.Exception) {
+	if target.Exchange != "SPOT" {
+		return nil, throw.ErrInvalidExchange
+	}
+	candles, err := fetchBlock(ctx, from, target, listed)
+	if err != nil {
+		// the caller gave up, this is not an upstream failure
+		if ex := throw.FromContext(ctx); ex != nil {
+			return nil, ex.WithBroker(config.SourceCoinbase)
+		}
+		logger.Ctx(ctx).Error("failed fetching block",
+			logger.F("broker", target.Broker),
+			logger.F("exchange", target.Exchange),
+			logger.F("symbol", target.Symbol),
+			logger.F("from", from.Unix()),
+			logger.F("interval", candlestick.Interval1m),
+			logger.F("error", err),
+		)
+		return nil, throw.New(err, throw.ErrKindUnexpected).WithBroker(config.SourceCoinbase)
+	}
+	return candles, nil
+}
+
+func FetchLatest(ctx context.Context, from int64, target candlestick.AssetIdentifier) ([]candlestick.Candle, throw.Exception) {
+	if target.Exchange != "SPOT" {
+		return nil, throw.ErrInvalidExchange
+	}
+	candles, err := fetchPage(ctx, target.Symbol, from, from+(LatestSize-1)*minute)
+	if err != nil {
+		if ex := throw.FromContext(ctx); ex != nil {
+			return nil, ex.WithBroker(config.SourceCoinbase)
+		}
+		logger.Ctx(ctx).Error("failed fetching latest candles",
+			logger.F("broker", target.Broker),
+			logger.F("exchange", target.Exchange),
+			logger.F("symbol", target.Symbol),
+			logger.F("from", from),
+			logger.F("error", err),
+		)
+		return nil, throw.New(err, throw.ErrKindUnexpected).WithBroker(config.SourceCoinbase)
+	}
+	return candles, nil
+}
+
+// fetchBlock requests the pages of a block and places them on the one minute grid
+func fetchBlock(ctx context.Context, from time.Time, target candlestick.AssetIdentifier, listed int64) ([]candlestick.Candle, error) {
+	candles := make([]candlestick.Candle, 0, BlockSize)
+	now := time.Now().UTC().Unix()
+	for start := from.Unix(); start < from.Unix()+BlockSize*minute; start += pageLimit * minute {
+		if start > now+15*minute {
+			break
+		}
+		end := start + (pageLimit-1)*minute
+		if last := from.Unix() + (BlockSize-1)*minute; end > last {
+			end = last
+		}
+		page, err := fetchPage(ctx, target.Symbol, start, end)
+		if err != nil {
+			return nil, err
+		}
+		candles = append(candles, page...)
+	}
+	return fillMissingCandles(ctx, candles, from, target, listed)
+}
+
+// fetchPage returns the one minute candles in [start, end] sorted by time
+func fetchPage(ctx context.Context, product string, start int64, end int64) ([]candlestick.Candle, error) {
+	return fetchGranularity(ctx, product, minute, start, end)
+}
+
+// fetchGranularity returns the candles of granularity seconds in [start, end] sorted by time
+func fetchGranularity(ctx context.Context, product string, granularity int64, start int64, end int64) (candles []candlestick.Candle, err error) {
+	ctx, span := tracing.Start(ctx, "coinbase.candles",
+		attribute.String("broker", config.SourceCoinbase),
+		attribute.String("symbol", product),
+		attribute.Int64("granularity", granularity),
+		attribute.Int64("from", start),
+	)
+	defer func() { tracing.End(span, err) }()
+
+	query := url.Values{}
+	query.Set("granularity", strconv.FormatInt(granularity, 10))
+	query.Set("start", time.Unix(start, 0).UTC().Format(time.RFC3339))
+	query.Set("end", time.Unix(end, 0).UTC().Format(time.RFC3339))
+
+	// rows are time, low, high, open, close and volume, newest first
+	rows := make([][]float64, 0)
+	if err = get(ctx, fmt.Sprintf("/products/%s/candles?%s", url.PathEscape(product), query.Encode()), &rows); err != nil {
+		return nil, err
+	}
+
+	candles = make([]candlestick.Candle, 0, len(rows))
+	for _, row := range rows {
+		if len(row) < 6 {
+			return nil, fmt.Errorf("invalid candle %v", row)
+		}
+		t := int64(row[0])
+		if t < start || t > end {
+			continue
+		}
+		candles = append(candles, candlestick.Candle{
+			Open:   row[3],
+			High:   row[2],
+			Low:    row[1],
+			Close:  row[4],
+			Volume: row[5],
+			Time:   t,
+		})
+	}
+	sort.Slice(candles, func(i, j int) bool { return candles[i].Time < candles[j].Time })
+	return candles, nil
+}
+
+// fillMissingCandles places candles on a one minute grid starting at from. Coinbase
+// leaves out minutes without trades, holes of up to quietMinutes get flat candles
+// without volume at the previous close like the klines of Binance. Longer holes are
+// outages, their minutes are missing and recorded in the gap index. Minutes before the
+// listing at listed or which are not published yet are missing without being recorded.
+func fillMissingCandles(ctx context.Context, candles []candlestick.Candle, from time.Time, target candlestick.AssetIdentifier, listed int64) ([]candlestick.Candle, error) {
+
+	log := logger.Ctx(ctx).With(
+		logger.F("broker", config.SourceCoinbase),
+		logger.F("exchange", target.Exchange),
+		logger.F("symbol", target.Symbol),
+		logger.F("from", from.Unix()),
+		logger.F("interval", candlestick.Interval1m),
+	)
+
+	if len(candles) > 0 && candles[0].Time < from.Unix() {
+		return nil, fmt.Errorf("response is invalid, candles start at %d while %d was requested", candles[0].Time, from.Unix())
+	}
+
+	results := make([]candlestick.Candle, 0, BlockSize)
+
+	// fill appends the minutes in [start, end) which have no candle, price is the close
+	// quiet minutes keep and is nil when there is none
+	fill := func(start int64, end int64, price *float64) {
+		listedFrom := start
+		if listedFrom < listed {
+			listedFrom += (listed - listedFrom + minute - 1) / minute * minute
+		}
+		outage := end > listedFrom && (price == nil || (end-listedFrom)/minute > quietMinutes)
+		if outage {
+			gaps.Record(target, candlestick.Interval1m, listedFrom, (end-listedFrom)/minute)
+		}
+		for t := start; t < end && len(results) < BlockSize; t += minute {
+			if t < listed || outage {
+				results = append(results, candlestick.Candle{Time: t, Missing: true})
+			} else {
+				results = append(results, candlestick.Candle{Time: t, Open: *price, High: *price, Low: *price, Close: *price})
+			}
+		}
+	}
+
+	var previous *candlestick.Candle
+	last := from.Unix() - minute
+	for i := range candles {
+		c := candles[i]
+
+		// duplicate or out of order candles would break the time grid
+		if c.Time <= last {
+			log.Warn("dropped out of order candle", logger.F("time", c.Time), logger.F("previous", last))
+			continue
+		}
+
+		// the first candle of a block opens at the close of the minutes before it
+		price := c.Open
+		if previous != nil {
+			price = previous.Close
+		}
+		fill(last+minute, c.Time, &price)
+		if len(results) == BlockSize {
+			return results, nil
+		}
+
+		last = c.Time
+		results = append(results, c)
+		previous = &candles[i]
+		if len(results) == BlockSize {
+			return results, nil
+		}
+	}
+
+	// minutes after the last candle are only known once they are published
+	now := time.Now().UTC().Unix()
+	published := now - now%minute - publishDelay
+	end := from.Unix() + BlockSize*minute
+	if end > published {
+		end = published
+	}
+	if end > last+minute {
+		var price *float64
+		if previous != nil {
+			price = &previous.Close
+		}
+		fill(last+minute, end, price)
+	}
+	for t := from.Unix() + int64(len(results))*minute; len(results) < BlockSize; t += minute {
+		results = append(results, candlestick.Candle{Time: t, Missing: true})
+	}
+	return results, nil
+}
@@ -0,0 +1,167 @@
+package coinbase
+
+import (
+	"context"
+	"github.com/godoji/candlestick"
+	"marlin/internal/fixture"
+	"marlin/internal/gaps"
+	"math"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	// fixtures are looked up relative to the repository root
+	if err := os.Chdir("../.."); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+// start of the block the tests fill, long closed so nothing is clipped to now
+const blockStart = int64(1699980000)
+
+// candles returns one minute candles at the given minutes of the test block
+func candles(minutes ...int64) []candlestick.Candle {
+	result := make([]candlestick.Candle, len(minutes))
+	for i, m := range minutes {
+		result[i] = candlestick.Candle{Time: blockStart + m*60, Open: 1, High: 2, Low: 1, Close: 2, Volume: 1}
+	}
+	return result
+}
+
+// span returns the minutes in [from, to)
+func span(from int64, to int64) []int64 {
+	result := make([]int64, 0, to-from)
+	for m := from; m < to; m++ {
+		result = append(result, m)
+	}
+	return result
+}
+
+func without(minutes []int64, from int64, to int64) []int64 {
+	result := make([]int64, 0, len(minutes))
+	for _, m := range minutes {
+		if m < from || m >= to {
+			result = append(result, m)
+		}
+	}
+	return result
+}
+
+func TestFillMissingCandles(t *testing.T) {
+	tests := []struct {
+		name    string
+		candles []candlestick.Candle
+		listed  int64
+		quiet   []int64 // minutes expected to be flat
+		missing []int64 // minutes expected to be missing
+		gaps    [][2]int64
+	}{
+		{
+			name:    "complete",
+			candles: candles(span(0, 1000)...),
+			listed:  math.MinInt64,
+		},
+		{
+			name:    "quiet minutes",
+			candles: candles(without(span(0, 1000), 10, 10+quietMinutes)...),
+			listed:  math.MinInt64,
+			quiet:   span(10, 10+quietMinutes),
+		},
+		{
+			name:    "outage",
+			candles: candles(without(span(0, 1000), 10, 11+quietMinutes)...),
+			listed:  math.MinInt64,
+			missing: span(10, 11+quietMinutes),
+			gaps:    [][2]int64{{blockStart + 600, quietMinutes + 1}},
+		},
+		{
+			name:    "trailing outage",
+			candles: candles(span(0, 990)...),
+			listed:  math.MinInt64,
+			missing: span(990, 1000),
+			gaps:    [][2]int64{{blockStart + 990*60, 10}},
+		},
+		{
+			name:    "before listing",
+			candles: candles(span(20, 1000)...),
+			listed:  blockStart + 20*60,
+			missing: span(0, 20),
+		},
+		{
+			name:    "empty block",
+			listed:  math.MinInt64,
+			missing: span(0, 1000),
+			gaps:    [][2]int64{{blockStart, 1000}},
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			target := candlestick.NewAssetIdentifier("COINBASE", "SPOT", "TEST"+string(rune('A'+i))+"-USD")
+			result, err := fillMissingCandles(context.Background(), test.candles, time.Unix(blockStart, 0), target, test.listed)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(result) != BlockSize {
+				t.Fatalf("got %d candles, want %d", len(result), BlockSize)
+			}
+
+			quiet, missing := make(map[int64]bool), make(map[int64]bool)
+			for _, m := range test.quiet {
+				quiet[m] = true
+			}
+			for _, m := range test.missing {
+				missing[m] = true
+			}
+			for m, c := range result {
+				if want := blockStart + int64(m)*60; c.Time != want {
+					t.Fatalf("candle %d at %d, want %d", m, c.Time, want)
+				}
+				if c.Missing != missing[int64(m)] {
+					t.Errorf("candle %d missing is %v, want %v", m, c.Missing, missing[int64(m)])
+				}
+				if isQuiet := !c.Missing && c.Volume == 0; isQuiet != quiet[int64(m)] {
+					t.Errorf("candle %d quiet is %v, want %v", m, isQuiet, quiet[int64(m)])
+				}
+			}
+
+			recorded := gaps.Find(target, blockStart, blockStart+BlockSize*60)
+			if len(recorded) != len(test.gaps) {
+				t.Fatalf("recorded %d gaps, want %d: %+v", len(recorded), len(test.gaps), recorded)
+			}
+			for j, g := range recorded {
+				if g.Start != test.gaps[j][0] || g.Length != test.gaps[j][1] {
+					t.Errorf("gap %d is %d+%d, want %d+%d", j, g.Start, g.Length, test.gaps[j][0], test.gaps[j][1])
+				}
+			}
+		})
+	}
+}
+
+func TestFetchCandlesReplay(t *testing.T) {
+	Configure(&http.Client{Transport: &fixture.Transport{Dir: "./testdata/fixtures", Mode: fixture.ModeReplay}}, "")
+
+	// the recorded block holds the ten minute outage of the example scenario
+	target := candlestick.NewAssetIdentifier("COINBASE", "SPOT", "BTC-USD")
+	result, ex := FetchCandles(context.Background(), time.Unix(blockStart, 0), target, 1420070400)
+	if ex != nil {
+		t.Fatal(ex)
+	}
+	if len(result) != BlockSize {
+		t.Fatalf("got %d candles, want %d", len(result), BlockSize)
+	}
+	for _, c := range result {
+		outage := c.Time >= 1700001840 && c.Time < 1700002440
+		if c.Missing != outage {
+			t.Errorf("candle at %d missing is %v, want %v", c.Time, c.Missing, outage)
+		}
+	}
+	recorded := gaps.Find(target, blockStart, blockStart+BlockSize*60)
+	if len(recorded) != 1 || recorded[0].Start != 1700001840 || recorded[0].Length != 10 {
+		t.Errorf("recorded gaps %+v, want the outage at 1700001840 of 10 minutes", recorded)
+	}
+}
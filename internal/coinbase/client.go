@@ -0,0 +1,86 @@
+package coinbase
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"marlin/internal/config"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var httpClient = http.DefaultClient
+var baseURL = config.CoinbaseAPI
+
+// Configure routes all Coinbase calls through client, an empty base url keeps the default
+func Configure(client *http.Client, url string) {
+	httpClient = client
+	if url != "" {
+		baseURL = url
+	}
+}
+
+// public endpoints allow 10 requests per second per IP, some room is left for bursts
+const requestInterval = 125 * time.Millisecond
+
+var pacingLock = sync.Mutex{}
+var nextRequest time.Time
+
+// pace blocks until the next request may be sent or ctx is done
+func pace(ctx context.Context) error {
+	pacingLock.Lock()
+	now := time.Now()
+	if nextRequest.Before(now) {
+		nextRequest = now
+	}
+	wait := nextRequest.Sub(now)
+	nextRequest = nextRequest.Add(requestInterval)
+	pacingLock.Unlock()
+
+	if wait <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+type errorResponse struct {
+	Message string `json:"message"`
+}
+
+// get sends a paced request to path and decodes the json response into result
+func get(ctx context.Context, path string, result interface{}) error {
+	if err := pace(ctx); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL+path, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		e := errorResponse{}
+		if json.Unmarshal(body, &e) == nil && e.Message != "" {
+			return fmt.Errorf("%s: %s", resp.Status, e.Message)
+		}
+		return fmt.Errorf("%s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
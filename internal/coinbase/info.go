@@ -0,0 +1,174 @@
+package coinbase
+
+import (
+	"context"
+	"errors"
+	"github.com/godoji/candlestick"
+	"go.opentelemetry.io/otel/attribute"
+	"marlin/internal/config"
+	"marlin/internal/logger"
+	"marlin/internal/tracing"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type product struct {
+	Id              string `json:"id"`
+	BaseCurrency    string `json:"base_currency"`
+	QuoteCurrency   string `json:"quote_currency"`
+	QuoteIncrement  string `json:"quote_increment"`
+	BaseIncrement   string `json:"base_increment"`
+	MinMarketFunds  string `json:"min_market_funds"`
+	Status          string `json:"status"`
+	TradingDisabled bool   `json:"trading_disabled"`
+	CancelOnly      bool   `json:"cancel_only"`
+}
+
+// only dollar markets are served, like the USDT markets of Binance
+const quoteCurrency = "USD"
+
+func isProductValid(p product) bool {
+	return p.QuoteCurrency == quoteCurrency &&
+		p.Status == "online" &&
+		!p.TradingDisabled &&
+		!p.CancelOnly &&
+		config.SymbolList(config.SourceCoinbase)[p.BaseCurrency]
+}
+
+func fetchProducts(ctx context.Context) (products []product, err error) {
+	ctx, span := tracing.Start(ctx, "coinbase.products", attribute.String("broker", config.SourceCoinbase))
+	defer func() { tracing.End(span, err) }()
+	err = get(ctx, "/products", &products)
+	return products, err
+}
+
+// precision returns the number of decimals of an increment such as 0.001
+func precision(increment string) int {
+	if i := strings.IndexByte(increment, '.'); i >= 0 {
+		return len(strings.TrimRight(increment[i+1:], "0"))
+	}
+	return 0
+}
+
+// the exchange opened in 2015, no product has candles before
+const exchangeLaunch = int64(1420070400)
+
+var errNoCandles = errors.New("product has no candles")
+
+// Coinbase does not publish listing dates, the first candle of a product is looked up
+// once and kept for the lifetime of the process
+var listings = make(map[string]int64)
+var listingsLock = sync.Mutex{}
+
+func listedAt(ctx context.Context, product string) (int64, error) {
+	listingsLock.Lock()
+	t, ok := listings[product]
+	listingsLock.Unlock()
+	if ok {
+		return t, nil
+	}
+
+	// the lookup takes several paced requests, it is not done under the lock and
+	// concurrent lookups of the same product find the same candle
+	t, err := findFirstCandle(ctx, product)
+	if err != nil {
+		return 0, err
+	}
+	listingsLock.Lock()
+	listings[product] = t
+	listingsLock.Unlock()
+	return t, nil
+}
+
+// findFirstCandle looks for the first daily candle of product and narrows it down to
+// the hour and minute, which takes one request each
+func findFirstCandle(ctx context.Context, product string) (int64, error) {
+	first := int64(-1)
+	now := time.Now().UTC().Unix()
+	for start := exchangeLaunch; start < now && first < 0; start += pageLimit * day {
+		candles, err := fetchGranularity(ctx, product, day, start, start+(pageLimit-1)*day)
+		if err != nil {
+			return 0, err
+		}
+		if len(candles) > 0 {
+			first = candles[0].Time
+		}
+	}
+	if first < 0 {
+		return 0, errNoCandles
+	}
+	for _, step := range []struct{ granularity, span int64 }{{hour, day}, {minute, hour}} {
+		candles, err := fetchGranularity(ctx, product, step.granularity, first, first+step.span-step.granularity)
+		if err != nil {
+			return 0, err
+		}
+		if len(candles) > 0 {
+			first = candles[0].Time
+		}
+	}
+	return first, nil
+}
+
+func GetInfo(ctx context.Context) (*candlestick.ExchangeInfo, error) {
+
+	logger.Ctx(ctx).Info("fetch exchange info", logger.F("broker", config.SourceCoinbase), logger.F("exchange", "SPOT"))
+
+	result := &candlestick.ExchangeInfo{
+		Name:       "Coinbase Spot",
+		ExchangeId: "SPOT",
+		BrokerId:   config.SourceCoinbase,
+		LastUpdate: time.Now().UTC().Unix(),
+		Symbols:    make(map[string]*candlestick.AssetInfo),
+		Resolution: []int64{candlestick.Interval1m},
+	}
+
+	products, err := fetchProducts(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, p := range products {
+		if !isProductValid(p) {
+			continue
+		}
+		tickSize, _ := strconv.ParseFloat(p.QuoteIncrement, 64)
+		stepSize, _ := strconv.ParseFloat(p.BaseIncrement, 64)
+		minNotional, _ := strconv.ParseFloat(p.MinMarketFunds, 64)
+
+		// products which never traded have no listing date yet, a failed lookup is
+		// tried again with the next refresh instead of failing the whole exchange
+		onBoard, err := listedAt(ctx, p.Id)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			if !errors.Is(err, errNoCandles) {
+				logger.Ctx(ctx).Warn("could not find listing date", logger.F("broker", config.SourceCoinbase), logger.F("symbol", p.Id), logger.F("error", err))
+			}
+			onBoard = math.MinInt64
+		}
+
+		identifier := candlestick.NewAssetIdentifier(result.BrokerId, result.ExchangeId, p.Id)
+		result.Symbols[identifier.ToString()] = &candlestick.AssetInfo{
+			Identifier:         identifier,
+			Symbol:             identifier.ToString(),
+			Pair:               p.Id,
+			BaseAsset:          p.BaseCurrency,
+			BaseAssetPrecision: precision(p.BaseIncrement),
+			QuoteAsset:         p.QuoteCurrency,
+			QuotePrecision:     precision(p.QuoteIncrement),
+			OnBoardDate:        onBoard,
+			Splits:             []candlestick.AssetSplit{},
+			Constraints: candlestick.TradeConstraints{
+				TickSize:    tickSize,
+				StepSize:    stepSize,
+				MinNotional: minNotional,
+			},
+		}
+	}
+
+	return result, nil
+}
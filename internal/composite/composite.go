@@ -0,0 +1,112 @@
+package composite
+
+import (
+	"github.com/godoji/candlestick"
+	"math"
+	"sort"
+	"strings"
+)
+
+// composite modes, used as exchange of COMPOSITE identifiers such as COMPOSITE:FALLBACK:BTC
+const (
+	ModeFallback  = "FALLBACK"  // candles of the first venue which has them
+	ModeConsensus = "CONSENSUS" // volume weighted candles of all venues which have them
+)
+
+// Span marks the venues candles in [From, To) came from, consensus candles name all
+// venues joined by a plus
+type Span struct {
+	Source string `json:"source"`
+	From   int64  `json:"from"`
+	To     int64  `json:"to"`
+}
+
+// Merge aligns the candles of venues given in order of priority on their timestamps and
+// returns one candle for every time along with the venues it came from, times no venue
+// has are missing and have no source
+func Merge(mode string, venues []string, candles [][]candlestick.Candle) ([]candlestick.Candle, []string) {
+	byTime := make([]map[int64]candlestick.Candle, len(candles))
+	times := make([]int64, 0)
+	seen := make(map[int64]bool)
+	for i, list := range candles {
+		byTime[i] = make(map[int64]candlestick.Candle, len(list))
+		for _, c := range list {
+			byTime[i][c.Time] = c
+			if !seen[c.Time] {
+				seen[c.Time] = true
+				times = append(times, c.Time)
+			}
+		}
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i] < times[j] })
+
+	result := make([]candlestick.Candle, len(times))
+	sources := make([]string, len(times))
+	for i, t := range times {
+		available := make([]candlestick.Candle, 0, len(venues))
+		names := make([]string, 0, len(venues))
+		for v := range venues {
+			if c, ok := byTime[v][t]; ok && !c.Missing {
+				available = append(available, c)
+				names = append(names, venues[v])
+			}
+		}
+		switch {
+		case len(available) == 0:
+			result[i] = candlestick.Candle{Time: t, Missing: true}
+		case mode == ModeConsensus:
+			result[i] = consensus(available)
+			sources[i] = strings.Join(names, "+")
+		default:
+			result[i] = available[0]
+			sources[i] = names[0]
+		}
+	}
+	return result, sources
+}
+
+// consensus weighs the open and close of every venue by its volume, venues without volume
+// count equally when none has any. High and low span every venue.
+func consensus(candles []candlestick.Candle) candlestick.Candle {
+	total := 0.0
+	for _, c := range candles {
+		total += c.Volume
+	}
+	weight := func(c candlestick.Candle) float64 {
+		if total == 0 {
+			return 1 / float64(len(candles))
+		}
+		return c.Volume / total
+	}
+
+	result := candlestick.Candle{Time: candles[0].Time, High: candles[0].High, Low: candles[0].Low}
+	for _, c := range candles {
+		w := weight(c)
+		result.Open += w * c.Open
+		result.High = math.Max(result.High, c.High)
+		result.Low = math.Min(result.Low, c.Low)
+		result.Close += w * c.Close
+		result.Volume += c.Volume
+		result.TakerVolume += c.TakerVolume
+		result.NumberOfTrades += c.NumberOfTrades
+	}
+	result.High = math.Max(result.High, math.Max(result.Open, result.Close))
+	result.Low = math.Min(result.Low, math.Min(result.Open, result.Close))
+	return result
+}
+
+// Spans collapses the per candle sources of Merge into runs of the same source
+func Spans(candles []candlestick.Candle, sources []string, interval int64) []Span {
+	spans := make([]Span, 0)
+	for i, c := range candles {
+		if sources[i] == "" {
+			continue
+		}
+		if n := len(spans); n > 0 && spans[n-1].Source == sources[i] && spans[n-1].To == c.Time {
+			spans[n-1].To = c.Time + interval
+			continue
+		}
+		spans = append(spans, Span{Source: sources[i], From: c.Time, To: c.Time + interval})
+	}
+	return spans
+}
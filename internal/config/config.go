@@ -2,29 +2,77 @@ package config
 
 import (
 	"flag"
-	"log"
+	"marlin/internal/logger"
+	"strings"
+	"time"
 )
 
 const (
-	SourceBinance = "BINANCE"
-	SourceUnicorn = "UNICORN"
+	SourceBinance   = "BINANCE"
+	SourceUnicorn   = "UNICORN"
+	SourceCoinbase  = "COINBASE"
+	SourceSynth     = "SYNTH"     // derived from other instruments
+	SourceComposite = "COMPOSITE" // the same asset merged across brokers
 )
 
+// routes with a configurable deadline
 const (
-	UnicornAPI = "https://eodhistoricaldata.com/api"
+	RouteHistorical = "historical"
+	RouteLatest     = "latest"
+	RouteExport     = "export"
+	RouteDepth      = "depth"
+	RouteTrades     = "trades"
+)
+
+const (
+	UnicornAPI  = "https://eodhistoricaldata.com/api"
+	CoinbaseAPI = "https://api.exchange.coinbase.com"
 )
 
 type Config struct {
 	port         string
+	grpcPort     string
 	isProduction bool
 	unicornKey   string
 	isOffline    bool
+	apiKeysPath  string
+	otelEndpoint string
+	shutdown     time.Duration
+	deadlines    map[string]time.Duration
+	gapRecheck   time.Duration
+	binanceRate  int
+	upstream     UpstreamConfig
+	depth        DepthRecorderConfig
+	venues       []string
+}
+
+// DepthRecorderConfig controls recording order books from the diff-depth streams
+type DepthRecorderConfig struct {
+	Enabled  bool
+	Interval time.Duration
+	Levels   int
+	Weight   int
+}
+
+// UpstreamConfig selects how brokers are reached, fixtures are recorded to or
+// replayed from the fixture directory
+type UpstreamConfig struct {
+	Mode              string
+	FixtureDir        string
+	BinanceSpotURL    string
+	BinanceFuturesURL string
+	UnicornURL        string
+	CoinbaseURL       string
 }
 
 func (c *Config) Port() string {
 	return c.port
 }
 
+func (c *Config) GrpcPort() string {
+	return c.grpcPort
+}
+
 func (c *Config) IsProduction() bool {
 	return c.isProduction
 }
@@ -37,36 +85,162 @@ func (c *Config) IsOffline() bool {
 	return c.isOffline
 }
 
+func (c *Config) ApiKeysPath() string {
+	return c.apiKeysPath
+}
+
+func (c *Config) OtelEndpoint() string {
+	return c.otelEndpoint
+}
+
+func (c *Config) ShutdownTimeout() time.Duration {
+	return c.shutdown
+}
+
+// Deadline returns how long a request on route may run before its upstream
+// calls are cancelled, zero means no deadline
+func (c *Config) Deadline(route string) time.Duration {
+	return c.deadlines[route]
+}
+
+func (c *Config) GapRecheckInterval() time.Duration {
+	return c.gapRecheck
+}
+
+// BinanceWeight returns the request weight marlin may spend on Binance per minute
+func (c *Config) BinanceWeight() int {
+	return c.binanceRate
+}
+
+func (c *Config) DepthRecorder() DepthRecorderConfig {
+	return c.depth
+}
+
+// CompositeVenues returns the brokers composite sources merge, in order of priority
+func (c *Config) CompositeVenues() []string {
+	return c.venues
+}
+
+func (c *Config) Upstream() UpstreamConfig {
+	return c.upstream
+}
+
 var serviceConfig = &Config{
 	port:         "9701",
+	grpcPort:     "9702",
 	isProduction: true,
 	unicornKey:   "",
 	isOffline:    false,
+	apiKeysPath:  "",
+	otelEndpoint: "",
+	shutdown:     30 * time.Second,
+	deadlines: map[string]time.Duration{
+		RouteHistorical: 30 * time.Second,
+		RouteLatest:     10 * time.Second,
+		RouteExport:     10 * time.Minute,
+		RouteDepth:      10 * time.Second,
+		RouteTrades:     time.Minute,
+	},
+	gapRecheck:  time.Hour,
+	binanceRate: 1200,
+	upstream: UpstreamConfig{
+		Mode:       "live",
+		FixtureDir: "./testdata/fixtures",
+	},
+	depth: DepthRecorderConfig{
+		Interval: time.Minute,
+		Levels:   100,
+		Weight:   600,
+	},
+	venues: []string{SourceBinance, SourceCoinbase},
 }
 
 func ServiceConfig() *Config {
 	return serviceConfig
 }
 
-func LoadConfig() {
+// LoadConfig registers the service flags on fs and parses args, commands register
+// their own flags on fs beforehand
+func LoadConfig(fs *flag.FlagSet, args []string) {
+
+	confPort := fs.String("port", "9701", "port from which to run the service")
+	confGrpcPort := fs.String("grpc-port", "9702", "port from which to run the gRPC service, empty to disable")
+	confUnicornKey := fs.String("unicorn-key", "", "Unicorn's EOD API key")
+	confIsOffline := fs.Bool("offline", false, "run in offline mode, exchange info and candles are only served from disk")
+	confApiKeys := fs.String("api-keys", "", "path to the api key file, requests are not authenticated when empty")
+	confOtelEndpoint := fs.String("otel-endpoint", "", "OTLP/HTTP collector address or 'stdout' to export traces, disabled when empty")
+	confShutdown := fs.Duration("shutdown-timeout", 30*time.Second, "time to drain in-flight requests before they are cancelled")
+	confHistoricalDeadline := fs.Duration("historical-deadline", 30*time.Second, "maximum duration of a historical request, 0 to disable")
+	confLatestDeadline := fs.Duration("latest-deadline", 10*time.Second, "maximum duration of a latest request, 0 to disable")
+	confExportDeadline := fs.Duration("export-deadline", 10*time.Minute, "maximum duration of an export request, 0 to disable")
+	confDepthDeadline := fs.Duration("depth-deadline", 10*time.Second, "maximum duration of a depth request, 0 to disable")
+	confTradesDeadline := fs.Duration("trades-deadline", time.Minute, "maximum duration of a trades or trade bars request, 0 to disable")
+	confRecordDepth := fs.Bool("record-depth", false, "record order books of all Binance symbols from the diff-depth streams")
+	confDepthInterval := fs.Duration("depth-interval", time.Minute, "how often recorded order books are saved")
+	confDepthLevels := fs.Int("depth-levels", 100, "levels per side saved with each recorded order book")
+	confDepthWeight := fs.Int("depth-weight", 600, "request weight per minute the depth recorder spends on Binance snapshots, on top of binance-weight")
+	confGapRecheck := fs.Duration("gap-recheck", time.Hour, "how often filled gaps are fetched again, 0 to disable")
+	confBinanceWeight := fs.Int("binance-weight", 1200, "request weight per minute to spend on Binance, 0 to disable limiting")
+	confCompositeVenues := fs.String("composite-venues", SourceBinance+","+SourceCoinbase, "comma separated brokers composite sources merge, the first one is preferred")
+	confUpstreamMode := fs.String("upstream", "live", "how brokers are reached: live, record or replay")
+	confFixtureDir := fs.String("fixtures", "./testdata/fixtures", "directory upstream fixtures are recorded to and replayed from")
+	confBinanceSpotURL := fs.String("binance-spot-url", "", "base url of the Binance spot API, empty for the default")
+	confBinanceFuturesURL := fs.String("binance-futures-url", "", "base url of the Binance futures API, empty for the default")
+	confUnicornURL := fs.String("unicorn-url", "", "base url of the EOD API, empty for the default")
+	confCoinbaseURL := fs.String("coinbase-url", "", "base url of the Coinbase Exchange API, empty for the default")
+	confIsTestMode := fs.String("mode", "test", "running mode, specify 'prod' to make all symbols available")
+	confLogLevel := fs.String("log-level", "info", "minimum log level: debug, info, warn or error")
+	confLogFormat := fs.String("log-format", "text", "log output format: text or json")
+	_ = fs.Parse(args)
 
-	confPort := flag.String("port", "9701", "port from which to run the service")
-	confUnicornKey := flag.String("unicorn-key", "", "Unicorn's EOD API key")
-	confIsOffline := flag.Bool("offline", false, "run in offline mode, exchange info will not be up-to-date")
-	confIsTestMode := flag.String("mode", "test", "running mode, specify 'prod' to make all symbols available")
-	flag.Parse()
+	level, ok := logger.ParseLevel(*confLogLevel)
+	logger.Setup(level, *confLogFormat == "json")
+	if !ok {
+		logger.Warn("unknown log level, using info", logger.F("level", *confLogLevel))
+	}
 
 	if *confIsTestMode == "prod" {
 		serviceConfig.isProduction = true
 	} else {
-		log.Println("warning: running in test mode")
+		logger.Warn("running in test mode")
 	}
 
 	if *confIsOffline {
-		log.Println("warning: running in offline mode, exchange info will not be up-to-date")
+		logger.Warn("running in offline mode, exchange info and candles are only served from disk")
 		serviceConfig.isOffline = *confIsOffline
 	}
 
 	serviceConfig.port = *confPort
+	serviceConfig.grpcPort = *confGrpcPort
 	serviceConfig.unicornKey = *confUnicornKey
+	serviceConfig.apiKeysPath = *confApiKeys
+	serviceConfig.otelEndpoint = *confOtelEndpoint
+	serviceConfig.shutdown = *confShutdown
+	serviceConfig.deadlines[RouteHistorical] = *confHistoricalDeadline
+	serviceConfig.deadlines[RouteLatest] = *confLatestDeadline
+	serviceConfig.deadlines[RouteExport] = *confExportDeadline
+	serviceConfig.deadlines[RouteDepth] = *confDepthDeadline
+	serviceConfig.deadlines[RouteTrades] = *confTradesDeadline
+	serviceConfig.depth = DepthRecorderConfig{
+		Enabled:  *confRecordDepth,
+		Interval: *confDepthInterval,
+		Levels:   *confDepthLevels,
+		Weight:   *confDepthWeight,
+	}
+	serviceConfig.gapRecheck = *confGapRecheck
+	serviceConfig.binanceRate = *confBinanceWeight
+	serviceConfig.venues = nil
+	for _, venue := range strings.Split(*confCompositeVenues, ",") {
+		if venue = strings.ToUpper(strings.TrimSpace(venue)); venue != "" {
+			serviceConfig.venues = append(serviceConfig.venues, venue)
+		}
+	}
+	serviceConfig.upstream = UpstreamConfig{
+		Mode:              *confUpstreamMode,
+		FixtureDir:        *confFixtureDir,
+		BinanceSpotURL:    *confBinanceSpotURL,
+		BinanceFuturesURL: *confBinanceFuturesURL,
+		UnicornURL:        *confUnicornURL,
+		CoinbaseURL:       *confCoinbaseURL,
+	}
 }
@@ -2,7 +2,7 @@ package config
 
 import (
 	"io"
-	"log"
+	"marlin/internal/logger"
 	"os"
 	"strings"
 	"sync"
@@ -13,14 +13,15 @@ type SymbolSet = map[string]bool
 var whitelistLock = sync.Mutex{}
 var whitelistCache = map[string]SymbolSet{}
 var dataBrokerIdentifier = map[string]string{
-	SourceBinance: "binance",
-	SourceUnicorn: "unicorn",
+	SourceBinance:  "binance",
+	SourceUnicorn:  "unicorn",
+	SourceCoinbase: "coinbase",
 }
 
 func loadSymbolList(source string) {
 	identifier, ok := dataBrokerIdentifier[source]
 	if !ok {
-		log.Fatalf("invalid broker %s\n", source)
+		logger.Fatal("invalid broker", logger.F("broker", source))
 	}
 
 	testSuffix := ""
@@ -30,12 +31,12 @@ func loadSymbolList(source string) {
 
 	f, err := os.Open("./assets/" + identifier + testSuffix + ".txt")
 	if err != nil {
-		log.Fatalf("missing symbol for %s\n", identifier)
+		logger.Fatal("missing symbol list", logger.F("broker", identifier))
 	}
 
 	data, err := io.ReadAll(f)
 	if err != nil {
-		log.Fatalf("could not read symbol list for %s\n", identifier)
+		logger.Fatal("could not read symbol list", logger.F("broker", identifier), logger.F("error", err))
 	}
 
 	pairs := strings.Split(string(data), "\n")
@@ -47,7 +48,7 @@ func loadSymbolList(source string) {
 		whitelistCache[source][pair] = true
 	}
 
-	log.Printf("symbol list for %s loaded, contains %d symbols\n", identifier, len(whitelistCache[source]))
+	logger.Info("symbol list loaded", logger.F("broker", identifier), logger.F("symbols", len(whitelistCache[source])))
 }
 
 func SymbolList(source string) SymbolSet {
@@ -0,0 +1,42 @@
+package datalock
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// the jobs, gap index and candle store below ./data are only written by one process
+const lockPath = "./data/marlin.lock"
+
+var ErrLocked = errors.New("the data directory is in use by another marlin process")
+
+// Acquire locks the data directory, it fails right away with ErrLocked while another
+// process holds the lock. The lock is released by release or when the process exits.
+func Acquire() (release func(), err error) {
+	if err = os.MkdirAll(filepath.Dir(lockPath), 0755); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(lockPath, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err = lock(file); err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+
+	// the pid tells who holds the lock
+	if err = file.Truncate(0); err == nil {
+		_, err = file.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+	}
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	return func() {
+		unlock(file)
+		_ = file.Close()
+	}, nil
+}
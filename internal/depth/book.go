@@ -0,0 +1,103 @@
+package depth
+
+import (
+	"sort"
+	"sync"
+)
+
+type Level struct {
+	Price    float64 `json:"p"`
+	Quantity float64 `json:"q"`
+}
+
+// Snapshot is the state of an order book, bids are sorted from the best (highest)
+// price down and asks from the best (lowest) price up. Time is in unix milliseconds.
+type Snapshot struct {
+	Symbol       string  `json:"symbol"`
+	Time         int64   `json:"time"`
+	LastUpdateId int64   `json:"lastUpdateId"`
+	Bids         []Level `json:"bids"`
+	Asks         []Level `json:"asks"`
+}
+
+// Book is a local order book kept up to date with diff updates
+type Book struct {
+	lock         sync.Mutex
+	symbol       string
+	time         int64
+	lastUpdateId int64
+	bids         map[float64]float64
+	asks         map[float64]float64
+}
+
+func NewBook(s *Snapshot) *Book {
+	b := &Book{
+		symbol:       s.Symbol,
+		time:         s.Time,
+		lastUpdateId: s.LastUpdateId,
+		bids:         make(map[float64]float64, len(s.Bids)),
+		asks:         make(map[float64]float64, len(s.Asks)),
+	}
+	for _, l := range s.Bids {
+		b.bids[l.Price] = l.Quantity
+	}
+	for _, l := range s.Asks {
+		b.asks[l.Price] = l.Quantity
+	}
+	return b
+}
+
+func (b *Book) LastUpdateId() int64 {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.lastUpdateId
+}
+
+// Apply sets the quantity of every given level, a quantity of zero removes the level
+func (b *Book) Apply(time int64, lastUpdateId int64, bids []Level, asks []Level) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	apply := func(side map[float64]float64, levels []Level) {
+		for _, l := range levels {
+			if l.Quantity == 0 {
+				delete(side, l.Price)
+			} else {
+				side[l.Price] = l.Quantity
+			}
+		}
+	}
+	apply(b.bids, bids)
+	apply(b.asks, asks)
+	b.time = time
+	b.lastUpdateId = lastUpdateId
+}
+
+// Snapshot returns the best limit levels on each side
+func (b *Book) Snapshot(limit int) *Snapshot {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return &Snapshot{
+		Symbol:       b.symbol,
+		Time:         b.time,
+		LastUpdateId: b.lastUpdateId,
+		Bids:         levels(b.bids, limit, true),
+		Asks:         levels(b.asks, limit, false),
+	}
+}
+
+func levels(side map[float64]float64, limit int, descending bool) []Level {
+	result := make([]Level, 0, len(side))
+	for price, quantity := range side {
+		result = append(result, Level{Price: price, Quantity: quantity})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if descending {
+			return result[i].Price > result[j].Price
+		}
+		return result[i].Price < result[j].Price
+	})
+	if limit > 0 && len(result) > limit {
+		result = result[:limit]
+	}
+	return result
+}
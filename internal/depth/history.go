@@ -0,0 +1,92 @@
+package depth
+
+import (
+	"bufio"
+	"encoding/json"
+	"github.com/godoji/candlestick"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const historyPath = "./data/depth"
+
+// snapshots are appended to one json lines file per asset and UTC day
+var historyLock = sync.Mutex{}
+
+func dayPath(target candlestick.AssetIdentifier, day time.Time) string {
+	return filepath.Join(historyPath, target.Broker, target.Exchange, target.Symbol, day.UTC().Format("2006-01-02")+".jsonl")
+}
+
+// Save appends a snapshot to the history of target
+func Save(target candlestick.AssetIdentifier, s *Snapshot) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	historyLock.Lock()
+	defer historyLock.Unlock()
+
+	path := dayPath(target, time.UnixMilli(s.Time))
+	if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err = file.Write(append(data, '\n')); err != nil {
+		_ = file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// At returns the last snapshot of target taken at or before t in unix seconds,
+// snapshots are looked up in the day of t and the day before
+func At(target candlestick.AssetIdentifier, t int64) (*Snapshot, bool, error) {
+	historyLock.Lock()
+	defer historyLock.Unlock()
+
+	limit := t * 1000
+	day := time.Unix(t, 0).UTC()
+	for _, d := range []time.Time{day, day.AddDate(0, 0, -1)} {
+		s, err := lastBefore(dayPath(target, d), limit)
+		if err != nil {
+			return nil, false, err
+		}
+		if s != nil {
+			return s, true, nil
+		}
+	}
+	return nil, false, nil
+}
+
+func lastBefore(path string, limit int64) (*Snapshot, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var found *Snapshot
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		s := new(Snapshot)
+		// a line cut short by a crash is skipped
+		if json.Unmarshal(scanner.Bytes(), s) != nil {
+			continue
+		}
+		if s.Time > limit {
+			break
+		}
+		found = s
+	}
+	return found, scanner.Err()
+}
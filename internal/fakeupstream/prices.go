@@ -0,0 +1,40 @@
+package fakeupstream
+
+import (
+	"hash/fnv"
+	"math"
+)
+
+// price returns a deterministic price around base for symbol at time t, candles of the
+// same symbol and time are identical across runs
+func price(symbol string, base float64, t int64) float64 {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(symbol))
+	phase := float64(h.Sum32()%1000) / 1000 * 2 * math.Pi
+
+	x := float64(t)
+	weekly := 0.2 * math.Sin(x/(7*86400)*2*math.Pi+phase)
+	hourly := 0.02 * math.Sin(x/3600*2*math.Pi+2*phase)
+	minute := 0.002 * math.Sin(x/300*2*math.Pi+3*phase)
+	return base * (1 + weekly + hourly + minute)
+}
+
+type ohlcv struct {
+	open, high, low, close, volume float64
+	trades                         int64
+}
+
+func candle(symbol string, base float64, t int64, interval int64) ohlcv {
+	o := price(symbol, base, t)
+	c := price(symbol, base, t+interval)
+	spread := math.Abs(o-c) * 0.5
+	volume := 100 + 50*math.Sin(float64(t)/1800+o)
+	return ohlcv{
+		open:   o,
+		high:   math.Max(o, c) + spread,
+		low:    math.Min(o, c) - spread,
+		close:  c,
+		volume: volume,
+		trades: int64(volume * 3),
+	}
+}
@@ -0,0 +1,123 @@
+package fakeupstream
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Duration reads durations such as "250ms" from scenario files
+type Duration struct {
+	time.Duration
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	value, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = value
+	return nil
+}
+
+// Range is a period in unix seconds [From, To) in which no candles exist
+type Range struct {
+	From int64 `json:"from"`
+	To   int64 `json:"to"`
+}
+
+type RateLimit struct {
+	// requests per minute before 429 responses are returned, zero disables limiting
+	PerMinute int `json:"perMinute"`
+	// number of 429 responses ignored by the client before it is banned with 418
+	BanAfter int      `json:"banAfter"`
+	BanFor   Duration `json:"banFor"`
+}
+
+type BinanceMarket struct {
+	Exchange  string  `json:"exchange"`
+	Symbol    string  `json:"symbol"`
+	BaseAsset string  `json:"baseAsset"`
+	Price     float64 `json:"price"`
+	Listed    int64   `json:"listed"`
+	// delisted markets report status BREAK and have no candles from then on
+	Delisted  int64    `json:"delisted"`
+	Gaps      []Range  `json:"gaps"`
+	Malformed []int64  `json:"malformed"`
+	Latency   Duration `json:"latency"`
+}
+
+type CoinbaseProduct struct {
+	Id        string  `json:"id"`
+	BaseAsset string  `json:"baseAsset"`
+	Price     float64 `json:"price"`
+	Listed    int64   `json:"listed"`
+	// delisted products report status delisted and have no candles from then on
+	Delisted int64    `json:"delisted"`
+	Gaps     []Range  `json:"gaps"`
+	Latency  Duration `json:"latency"`
+}
+
+type Split struct {
+	Date  string `json:"date"`
+	Split string `json:"split"`
+}
+
+type UnicornAsset struct {
+	Exchange string   `json:"exchange"`
+	Symbol   string   `json:"symbol"`
+	Price    float64  `json:"price"`
+	Listed   string   `json:"listed"`
+	Splits   []Split  `json:"splits"`
+	Gaps     []Range  `json:"gaps"`
+	Latency  Duration `json:"latency"`
+}
+
+// Scenario drives the behaviour of the fake upstream
+type Scenario struct {
+	Latency   Duration          `json:"latency"`
+	RateLimit RateLimit         `json:"rateLimit"`
+	Binance   []BinanceMarket   `json:"binance"`
+	Unicorn   []UnicornAsset    `json:"unicorn"`
+	Coinbase  []CoinbaseProduct `json:"coinbase"`
+}
+
+func LoadScenario(path string) (*Scenario, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	s := new(Scenario)
+	decoder := json.NewDecoder(file)
+	decoder.DisallowUnknownFields()
+	if err = decoder.Decode(s); err != nil {
+		return nil, fmt.Errorf("invalid scenario %s: %w", path, err)
+	}
+	for _, m := range s.Binance {
+		if m.Exchange != "SPOT" && m.Exchange != "PERP" {
+			return nil, fmt.Errorf("invalid scenario %s: unknown exchange %q for %s", path, m.Exchange, m.Symbol)
+		}
+	}
+	for _, a := range s.Unicorn {
+		if _, err = time.Parse("2006-01-02", a.Listed); err != nil {
+			return nil, fmt.Errorf("invalid scenario %s: listing date of %s: %w", path, a.Symbol, err)
+		}
+	}
+	return s, nil
+}
+
+func inGap(gaps []Range, t int64) bool {
+	for _, g := range gaps {
+		if t >= g.From && t < g.To {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,504 @@
+package fakeupstream
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/gorilla/mux"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const minute = int64(60)
+
+// server implements the subset of the Binance and EOD APIs used by marlin
+type server struct {
+	scenario *Scenario
+
+	lock        sync.Mutex
+	window      time.Time
+	requests    int
+	rejected    int
+	bannedUntil time.Time
+}
+
+// NewServer serves scenario, point marlin's Binance and Coinbase base urls at the
+// server root and its EOD base url at /api
+func NewServer(scenario *Scenario) http.Handler {
+	s := &server{scenario: scenario}
+
+	r := mux.NewRouter()
+	r.HandleFunc("/api/v3/exchangeInfo", s.handleExchangeInfo("SPOT")).Methods("GET")
+	r.HandleFunc("/api/v3/klines", s.handleKlines("SPOT")).Methods("GET")
+	r.HandleFunc("/fapi/v1/exchangeInfo", s.handleExchangeInfo("PERP")).Methods("GET")
+	r.HandleFunc("/fapi/v1/klines", s.handleKlines("PERP")).Methods("GET")
+	r.HandleFunc("/api/v3/depth", s.handleDepth("SPOT")).Methods("GET")
+	r.HandleFunc("/fapi/v1/depth", s.handleDepth("PERP")).Methods("GET")
+	r.HandleFunc("/api/v3/aggTrades", s.handleTrades("SPOT")).Methods("GET")
+	r.HandleFunc("/fapi/v1/aggTrades", s.handleTrades("PERP")).Methods("GET")
+	r.HandleFunc("/api/eod/{ticker}", s.handleEOD).Methods("GET")
+	r.HandleFunc("/api/splits/{ticker}", s.handleSplits).Methods("GET")
+	r.HandleFunc("/products", s.handleProducts).Methods("GET")
+	r.HandleFunc("/products/{id}/candles", s.handleCoinbaseCandles).Methods("GET")
+	r.Use(s.limit)
+	return r
+}
+
+func writeBinanceError(w http.ResponseWriter, status int, code int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"code": code, "msg": msg})
+}
+
+// limit applies the scenario latency and rate limit, clients which keep sending
+// requests after being rejected get banned like Binance does
+func (s *server) limit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(s.scenario.Latency.Duration)
+
+		rl := s.scenario.RateLimit
+		if rl.PerMinute > 0 {
+			s.lock.Lock()
+			now := time.Now()
+			if now.Before(s.bannedUntil) {
+				wait := s.bannedUntil.Sub(now)
+				s.lock.Unlock()
+				w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+				writeBinanceError(w, http.StatusTeapot, -1003, "Way too many requests; IP banned.")
+				return
+			}
+			if now.Sub(s.window) >= time.Minute {
+				s.window = now
+				s.requests = 0
+			}
+			s.requests++
+			if s.requests > rl.PerMinute {
+				s.rejected++
+				if rl.BanAfter > 0 && s.rejected > rl.BanAfter {
+					s.bannedUntil = now.Add(rl.BanFor.Duration)
+					s.rejected = 0
+				}
+				wait := s.window.Add(time.Minute).Sub(now)
+				s.lock.Unlock()
+				w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+				writeBinanceError(w, http.StatusTooManyRequests, -1003, "Too many requests.")
+				return
+			}
+			s.lock.Unlock()
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *server) market(exchange string, symbol string) *BinanceMarket {
+	for i := range s.scenario.Binance {
+		m := &s.scenario.Binance[i]
+		if m.Exchange == exchange && m.Symbol == symbol {
+			return m
+		}
+	}
+	return nil
+}
+
+func (s *server) handleExchangeInfo(exchange string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		now := time.Now().UTC().Unix()
+
+		// order count and notional filters are shaped differently per market
+		limits := []map[string]interface{}{
+			{"filterType": "MAX_NUM_ORDERS", "maxNumOrders": 200},
+			{"filterType": "MIN_NOTIONAL", "minNotional": "10.00000000"},
+		}
+		if exchange == "PERP" {
+			limits = []map[string]interface{}{
+				{"filterType": "MAX_NUM_ORDERS", "limit": 200},
+				{"filterType": "MIN_NOTIONAL", "notional": "100"},
+			}
+		}
+
+		symbols := make([]map[string]interface{}, 0)
+		for _, m := range s.scenario.Binance {
+			if m.Exchange != exchange {
+				continue
+			}
+			status := "TRADING"
+			if m.Delisted > 0 && now >= m.Delisted {
+				status = "BREAK"
+			}
+			symbols = append(symbols, map[string]interface{}{
+				"symbol":                 m.Symbol,
+				"pair":                   m.Symbol,
+				"status":                 status,
+				"contractType":           "PERPETUAL",
+				"baseAsset":              m.BaseAsset,
+				"quoteAsset":             "USDT",
+				"baseAssetPrecision":     8,
+				"quotePrecision":         8,
+				"isSpotTradingAllowed":   true,
+				"isMarginTradingAllowed": true,
+				"filters": append([]map[string]interface{}{
+					{"filterType": "PRICE_FILTER", "minPrice": "0.01", "maxPrice": "1000000.00", "tickSize": "0.01"},
+					{"filterType": "MARKET_LOT_SIZE", "minQty": "0.001", "maxQty": "1000.000", "stepSize": "0.001"},
+				}, limits...),
+			})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"timezone":   "UTC",
+			"serverTime": time.Now().UnixMilli(),
+			"symbols":    symbols,
+		})
+	}
+}
+
+func (s *server) handleKlines(exchange string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		m := s.market(exchange, q.Get("symbol"))
+		if m == nil {
+			writeBinanceError(w, http.StatusBadRequest, -1121, "Invalid symbol.")
+			return
+		}
+		step := minute
+		switch q.Get("interval") {
+		case "1m":
+		case "1d":
+			step = 24 * 60 * minute
+		default:
+			writeBinanceError(w, http.StatusBadRequest, -1120, "Invalid interval.")
+			return
+		}
+		limit, err := strconv.Atoi(q.Get("limit"))
+		if err != nil || limit <= 0 {
+			limit = 500
+		}
+		if limit > 1000 {
+			limit = 1000
+		}
+		startMs, _ := strconv.ParseInt(q.Get("startTime"), 10, 64)
+		time.Sleep(m.Latency.Duration)
+
+		malformed := make(map[int64]bool)
+		for _, t := range m.Malformed {
+			malformed[t] = true
+		}
+
+		// klines start at the first interval at or after startTime
+		t := (startMs/1000 + step - 1) / step * step
+		if t < m.Listed {
+			t = (m.Listed + step - 1) / step * step
+		}
+		now := time.Now().UTC().Unix()
+		klines := make([][]interface{}, 0, limit)
+		for ; len(klines) < limit && t <= now; t += step {
+			if m.Delisted > 0 && t >= m.Delisted {
+				break
+			}
+			if inGap(m.Gaps, t) {
+				continue
+			}
+			c := candle(m.Symbol, m.Price, t, step)
+			open := strconv.FormatFloat(c.open, 'f', 8, 64)
+			if malformed[t] {
+				open = "not-a-number"
+			}
+			klines = append(klines, []interface{}{
+				t * 1000,
+				open,
+				strconv.FormatFloat(c.high, 'f', 8, 64),
+				strconv.FormatFloat(c.low, 'f', 8, 64),
+				strconv.FormatFloat(c.close, 'f', 8, 64),
+				strconv.FormatFloat(c.volume, 'f', 8, 64),
+				(t+step)*1000 - 1,
+				strconv.FormatFloat(c.volume*c.close, 'f', 8, 64),
+				c.trades,
+				strconv.FormatFloat(c.volume/2, 'f', 8, 64),
+				strconv.FormatFloat(c.volume*c.close/2, 'f', 8, 64),
+				"0",
+			})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(klines)
+	}
+}
+
+// handleDepth serves a book spread evenly around the price of the current minute
+func (s *server) handleDepth(exchange string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		m := s.market(exchange, q.Get("symbol"))
+		if m == nil {
+			writeBinanceError(w, http.StatusBadRequest, -1121, "Invalid symbol.")
+			return
+		}
+		limit, err := strconv.Atoi(q.Get("limit"))
+		if err != nil || limit <= 0 {
+			limit = 100
+		}
+		if limit > 5000 {
+			limit = 5000
+		}
+		time.Sleep(m.Latency.Duration)
+
+		now := time.Now().UTC()
+		c := candle(m.Symbol, m.Price, now.Unix()/minute*minute, minute)
+		tick := c.close * 0.0001
+		bids := make([][]string, limit)
+		asks := make([][]string, limit)
+		for i := 0; i < limit; i++ {
+			quantity := strconv.FormatFloat(c.volume/float64(limit)*float64(i+1), 'f', 3, 64)
+			bids[i] = []string{strconv.FormatFloat(c.close-tick*float64(i+1), 'f', 8, 64), quantity}
+			asks[i] = []string{strconv.FormatFloat(c.close+tick*float64(i+1), 'f', 8, 64), quantity}
+		}
+
+		body := map[string]interface{}{
+			"lastUpdateId": now.UnixMilli(),
+			"bids":         bids,
+			"asks":         asks,
+		}
+		if exchange == "PERP" {
+			body["E"] = now.UnixMilli()
+			body["T"] = now.UnixMilli()
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(body)
+	}
+}
+
+// every traded minute holds tradesPerMinute aggregated trades, each filling two
+// trades, so trade ids follow from the time
+const tradesPerMinute = int64(20)
+
+func (s *server) handleTrades(exchange string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		m := s.market(exchange, q.Get("symbol"))
+		if m == nil {
+			writeBinanceError(w, http.StatusBadRequest, -1121, "Invalid symbol.")
+			return
+		}
+		limit, err := strconv.Atoi(q.Get("limit"))
+		if err != nil || limit <= 0 {
+			limit = 500
+		}
+		if limit > 1000 {
+			limit = 1000
+		}
+		time.Sleep(m.Latency.Duration)
+
+		now := time.Now().UTC().Unix()
+		startMs, endMs := int64(0), now*1000
+		first := int64(0)
+		if s := q.Get("fromId"); s != "" {
+			first, _ = strconv.ParseInt(s, 10, 64)
+		} else if q.Get("startTime") != "" {
+			startMs, _ = strconv.ParseInt(q.Get("startTime"), 10, 64)
+			if s := q.Get("endTime"); s != "" {
+				endMs, _ = strconv.ParseInt(s, 10, 64)
+				if endMs-startMs > 3600*1000 {
+					writeBinanceError(w, http.StatusBadRequest, -1127, "More than 1 hours between startTime and endTime.")
+					return
+				}
+			}
+			first = startMs / 1000 / minute * tradesPerMinute
+		} else {
+			first = (now/minute - 1) * tradesPerMinute
+		}
+
+		result := make([]map[string]interface{}, 0, limit)
+		for id := first; len(result) < limit; id++ {
+			t := id / tradesPerMinute * minute
+			ms := t*1000 + id%tradesPerMinute*(minute*1000/tradesPerMinute)
+			if ms > endMs || t >= now || (m.Delisted > 0 && t >= m.Delisted) {
+				break
+			}
+			if t < m.Listed {
+				id = (m.Listed+minute-1)/minute*tradesPerMinute - 1
+				continue
+			}
+			if ms < startMs || inGap(m.Gaps, t) {
+				continue
+			}
+			c := candle(m.Symbol, m.Price, t, minute)
+			step := float64(id%tradesPerMinute) / float64(tradesPerMinute-1)
+			result = append(result, map[string]interface{}{
+				"a": id,
+				"p": strconv.FormatFloat(c.open+(c.close-c.open)*step, 'f', 8, 64),
+				"q": strconv.FormatFloat(c.volume/float64(tradesPerMinute), 'f', 8, 64),
+				"f": id * 2,
+				"l": id*2 + 1,
+				"T": ms,
+				"m": id%3 == 0,
+			})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(result)
+	}
+}
+
+// asset resolves tickers such as AAPL.US
+func (s *server) asset(ticker string) *UnicornAsset {
+	parts := strings.SplitN(ticker, ".", 2)
+	if len(parts) != 2 {
+		return nil
+	}
+	for i := range s.scenario.Unicorn {
+		a := &s.scenario.Unicorn[i]
+		if a.Symbol == parts[0] && a.Exchange == parts[1] {
+			return a
+		}
+	}
+	return nil
+}
+
+func (s *server) handleEOD(w http.ResponseWriter, r *http.Request) {
+	a := s.asset(mux.Vars(r)["ticker"])
+	if a == nil {
+		http.Error(w, "Ticker Not Found.", http.StatusNotFound)
+		return
+	}
+	time.Sleep(a.Latency.Duration)
+
+	listed, _ := time.Parse("2006-01-02", a.Listed)
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+
+	w.Header().Set("Content-Type", "text/csv")
+	out := csv.NewWriter(w)
+	_ = out.Write([]string{"Date", "Open", "High", "Low", "Close", "Adjusted_close", "Volume"})
+	for day := listed.UTC(); day.Before(today); day = day.AddDate(0, 0, 1) {
+		if day.Weekday() == time.Saturday || day.Weekday() == time.Sunday || inGap(a.Gaps, day.Unix()) {
+			continue
+		}
+		// raw prices are not adjusted for later splits, only the adjusted close is
+		c := candle(a.Symbol, a.Price, day.Unix(), 86400)
+		factor := splitFactor(a.Splits, day)
+		_ = out.Write([]string{
+			day.Format("2006-01-02"),
+			strconv.FormatFloat(c.open*factor, 'f', 4, 64),
+			strconv.FormatFloat(c.high*factor, 'f', 4, 64),
+			strconv.FormatFloat(c.low*factor, 'f', 4, 64),
+			strconv.FormatFloat(c.close*factor, 'f', 4, 64),
+			strconv.FormatFloat(c.close, 'f', 4, 64),
+			fmt.Sprintf("%d", int64(c.volume*1000/factor)),
+		})
+	}
+	out.Flush()
+}
+
+// splitFactor returns the product of the ratios of all splits after day, the factor
+// unadjusted prices of day are higher than the adjusted ones
+func splitFactor(splits []Split, day time.Time) float64 {
+	factor := 1.0
+	for _, split := range splits {
+		date, err := time.Parse("2006-01-02", split.Date)
+		if err != nil || !day.Before(date) {
+			continue
+		}
+		var n, d float64
+		if _, err = fmt.Sscanf(split.Split, "%g/%g", &n, &d); err != nil || n <= 0 || d <= 0 {
+			continue
+		}
+		factor *= n / d
+	}
+	return factor
+}
+
+func (s *server) handleSplits(w http.ResponseWriter, r *http.Request) {
+	a := s.asset(mux.Vars(r)["ticker"])
+	if a == nil {
+		http.Error(w, "Ticker Not Found.", http.StatusNotFound)
+		return
+	}
+	splits := a.Splits
+	if splits == nil {
+		splits = []Split{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(splits)
+}
+
+func (s *server) product(id string) *CoinbaseProduct {
+	for i := range s.scenario.Coinbase {
+		if p := &s.scenario.Coinbase[i]; p.Id == id {
+			return p
+		}
+	}
+	return nil
+}
+
+func writeCoinbaseError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]string{"message": msg})
+}
+
+func (s *server) handleProducts(w http.ResponseWriter, r *http.Request) {
+	now := time.Now().UTC().Unix()
+	products := make([]map[string]interface{}, 0, len(s.scenario.Coinbase))
+	for _, p := range s.scenario.Coinbase {
+		status := "online"
+		if p.Delisted > 0 && now >= p.Delisted {
+			status = "delisted"
+		}
+		products = append(products, map[string]interface{}{
+			"id":               p.Id,
+			"base_currency":    p.BaseAsset,
+			"quote_currency":   "USD",
+			"quote_increment":  "0.01",
+			"base_increment":   "0.00000001",
+			"min_market_funds": "1",
+			"status":           status,
+			"trading_disabled": false,
+			"cancel_only":      false,
+		})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(products)
+}
+
+var coinbaseGranularities = map[int64]bool{60: true, 300: true, 900: true, 3600: true, 21600: true, 86400: true}
+
+// handleCoinbaseCandles serves candles in [start, end] newest first like Coinbase does
+func (s *server) handleCoinbaseCandles(w http.ResponseWriter, r *http.Request) {
+	p := s.product(mux.Vars(r)["id"])
+	if p == nil {
+		writeCoinbaseError(w, http.StatusNotFound, "NotFound")
+		return
+	}
+	q := r.URL.Query()
+	granularity, err := strconv.ParseInt(q.Get("granularity"), 10, 64)
+	if err != nil || !coinbaseGranularities[granularity] {
+		writeCoinbaseError(w, http.StatusBadRequest, "Unsupported granularity")
+		return
+	}
+	start, errStart := time.Parse(time.RFC3339, q.Get("start"))
+	end, errEnd := time.Parse(time.RFC3339, q.Get("end"))
+	if errStart != nil || errEnd != nil || end.Before(start) {
+		writeCoinbaseError(w, http.StatusBadRequest, "Invalid start or end")
+		return
+	}
+	if end.Sub(start) >= 300*time.Duration(granularity)*time.Second {
+		writeCoinbaseError(w, http.StatusBadRequest, "granularity too small for the requested time range. Count of aggregations requested exceeds 300")
+		return
+	}
+	time.Sleep(p.Latency.Duration)
+
+	now := time.Now().UTC().Unix()
+	rows := make([][]float64, 0)
+	for t := end.Unix() / granularity * granularity; t >= start.Unix(); t -= granularity {
+		// coarser candles exist as soon as any of their minutes traded
+		if t > now || t+granularity <= p.Listed || (p.Delisted > 0 && t >= p.Delisted) || (granularity == minute && inGap(p.Gaps, t)) {
+			continue
+		}
+		c := candle(p.Id, p.Price, t, granularity)
+		rows = append(rows, []float64{float64(t), c.low, c.high, c.open, c.close, c.volume})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(rows)
+}
@@ -0,0 +1,237 @@
+package gaps
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/godoji/candlestick"
+	"io"
+	"marlin/internal/atomicfile"
+	"marlin/internal/logger"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+const indexPath = "./data/gaps.json"
+
+// Gap is a run of candles the upstream did not return and which were filled in
+type Gap struct {
+	Broker      string `json:"broker"`
+	Exchange    string `json:"exchange"`
+	Symbol      string `json:"symbol"`
+	Interval    int64  `json:"interval"`
+	Start       int64  `json:"start"`
+	Length      int64  `json:"length"`
+	FirstSeen   int64  `json:"firstSeen"`
+	LastChecked int64  `json:"lastChecked"`
+	Checks      int    `json:"checks"`
+}
+
+func (g *Gap) Identifier() candlestick.AssetIdentifier {
+	return candlestick.NewAssetIdentifier(g.Broker, g.Exchange, g.Symbol)
+}
+
+// End returns the time of the first candle after the gap
+func (g *Gap) End() int64 {
+	return g.Start + g.Length*g.Interval
+}
+
+func (g *Gap) key() string {
+	return fmt.Sprintf("%s:%d@%d", g.Identifier().ToString(), g.Interval, g.Start)
+}
+
+// touches reports whether other is a gap of the same asset and interval which
+// overlaps or directly follows or precedes g
+func (g *Gap) touches(other *Gap) bool {
+	return g.Identifier().ToString() == other.Identifier().ToString() && g.Interval == other.Interval &&
+		other.Start <= g.End() && g.Start <= other.End()
+}
+
+// contains reports whether the entry g covers the start of other
+func (g *Gap) contains(other Gap) bool {
+	return g.Identifier().ToString() == other.Identifier().ToString() && g.Interval == other.Interval &&
+		g.Start <= other.Start && other.Start < g.End()
+}
+
+var index map[string]*Gap = nil
+var indexLock = sync.Mutex{}
+var indexDirty = false
+
+// Record adds a filled gap to the index, overlapping or adjacent gaps of the same
+// asset and interval are merged into a single entry
+func Record(target candlestick.AssetIdentifier, interval int64, start int64, length int64) {
+	if length <= 0 {
+		return
+	}
+	indexLock.Lock()
+	defer indexLock.Unlock()
+	load()
+
+	insert(&Gap{
+		Broker:    target.Broker,
+		Exchange:  target.Exchange,
+		Symbol:    target.Symbol,
+		Interval:  interval,
+		Start:     start,
+		Length:    length,
+		FirstSeen: time.Now().UTC().Unix(),
+	})
+	indexDirty = true
+}
+
+// Resolve removes the candles of g from the entry it was found in once they became
+// available, parts of the entry outside of g stay recorded
+func Resolve(g Gap) {
+	indexLock.Lock()
+	defer indexLock.Unlock()
+	load()
+
+	key, existing := entryOf(g)
+	if existing == nil {
+		return
+	}
+	delete(index, key)
+	if existing.Start < g.Start {
+		before := *existing
+		before.Length = (g.Start - existing.Start) / existing.Interval
+		index[before.key()] = &before
+	}
+	if g.End() < existing.End() {
+		after := *existing
+		after.Start = g.End()
+		after.Length = (existing.End() - g.End()) / existing.Interval
+		index[after.key()] = &after
+	}
+	indexDirty = true
+}
+
+// Checked registers a failed attempt to fill the gap
+func Checked(g Gap) {
+	indexLock.Lock()
+	defer indexLock.Unlock()
+	load()
+	if _, existing := entryOf(g); existing != nil {
+		existing.Checks++
+		existing.LastChecked = time.Now().UTC().Unix()
+		indexDirty = true
+	}
+}
+
+// insert merges g with every entry it touches and stores the result, the lock must
+// be held
+func insert(g *Gap) {
+	for merged := true; merged; {
+		merged = false
+		for key, existing := range index {
+			if !g.touches(existing) {
+				continue
+			}
+			end := g.End()
+			if existing.End() > end {
+				end = existing.End()
+			}
+			if existing.Start < g.Start {
+				g.Start = existing.Start
+			}
+			g.Length = (end - g.Start) / g.Interval
+			if existing.FirstSeen < g.FirstSeen {
+				g.FirstSeen = existing.FirstSeen
+			}
+			if existing.LastChecked > g.LastChecked {
+				g.LastChecked = existing.LastChecked
+			}
+			if existing.Checks > g.Checks {
+				g.Checks = existing.Checks
+			}
+			delete(index, key)
+			merged = true
+		}
+	}
+	index[g.key()] = g
+}
+
+// entryOf returns the entry covering a gap returned by Find, recording gaps in the
+// meantime can have merged it into a larger entry, the lock must be held
+func entryOf(g Gap) (string, *Gap) {
+	for key, existing := range index {
+		if existing.contains(g) {
+			return key, existing
+		}
+	}
+	return "", nil
+}
+
+// Find returns copies of all gaps overlapping [from, to) sorted by asset and time,
+// a nil target matches every asset and a zero to means no upper bound
+func Find(target candlestick.AssetIdentifier, from int64, to int64) []Gap {
+	indexLock.Lock()
+	defer indexLock.Unlock()
+	load()
+
+	result := make([]Gap, 0)
+	for _, g := range index {
+		if target != nil && g.Identifier().ToString() != target.ToString() {
+			continue
+		}
+		if g.End() <= from || (to > 0 && g.Start >= to) {
+			continue
+		}
+		result = append(result, *g)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i].Identifier().ToString(), result[j].Identifier().ToString()
+		if a != b {
+			return a < b
+		}
+		return result[i].Start < result[j].Start
+	})
+	return result
+}
+
+// Flush writes the index to disk if it changed since the last flush
+func Flush() {
+	indexLock.Lock()
+	defer indexLock.Unlock()
+	if !indexDirty {
+		return
+	}
+	err := atomicfile.WriteFile(indexPath, func(w io.Writer) error {
+		return json.NewEncoder(w).Encode(index)
+	})
+	if err != nil {
+		logger.Error("could not write gap index", logger.F("error", err))
+		return
+	}
+	indexDirty = false
+}
+
+// load reads the index from disk on first use, the lock must be held
+func load() {
+	if index != nil {
+		return
+	}
+	index = make(map[string]*Gap)
+
+	file, err := os.Open(indexPath)
+	if os.IsNotExist(err) {
+		return
+	}
+	if err != nil {
+		logger.Error("could not open gap index", logger.F("path", indexPath), logger.F("error", err))
+		return
+	}
+	defer file.Close()
+	stored := make(map[string]*Gap)
+	if err = json.NewDecoder(file).Decode(&stored); err != nil {
+		logger.Error("could not decode gap index, starting empty", logger.F("path", indexPath), logger.F("error", err))
+		return
+	}
+
+	// older indexes were keyed by start only and can hold overlapping entries
+	for _, g := range stored {
+		if g.Length > 0 && g.Interval > 0 {
+			insert(g)
+		}
+	}
+}
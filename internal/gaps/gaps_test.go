@@ -0,0 +1,43 @@
+package gaps
+
+import (
+	"github.com/godoji/candlestick"
+	"testing"
+)
+
+func TestRecordMerges(t *testing.T) {
+	target := candlestick.NewAssetIdentifier("COINBASE", "SPOT", "MERGE-USD")
+	minute := int64(candlestick.Interval1m)
+
+	// the same outage seen from two blocks and clipped differently
+	Record(target, minute, 1000*minute, 10)
+	Record(target, minute, 1005*minute, 10)
+	Record(target, minute, 1015*minute, 5)
+	Record(target, 60*minute, 1000*minute, 1)
+
+	found := Find(target, 0, 0)
+	if len(found) != 2 {
+		t.Fatalf("found %d gaps, want 2: %+v", len(found), found)
+	}
+	var merged Gap
+	for _, g := range found {
+		if g.Interval == minute {
+			merged = g
+		}
+	}
+	if merged.Start != 1000*minute || merged.Length != 20 {
+		t.Fatalf("merged gap is %d+%d, want %d+20", merged.Start, merged.Length, 1000*minute)
+	}
+
+	// resolving the middle of the entry keeps both ends recorded
+	Resolve(Gap{Broker: target.Broker, Exchange: target.Exchange, Symbol: target.Symbol, Interval: minute, Start: 1005 * minute, Length: 5})
+	found = Find(target, 0, 1100*minute)
+	if len(found) != 3 {
+		t.Fatalf("found %d gaps after resolving, want 3: %+v", len(found), found)
+	}
+	for _, g := range found {
+		if g.Interval == minute && g.Start == 1005*minute {
+			t.Errorf("resolved candles are still recorded: %+v", g)
+		}
+	}
+}
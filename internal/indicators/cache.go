@@ -0,0 +1,43 @@
+package indicators
+
+import (
+	"encoding/gob"
+	"fmt"
+	"github.com/godoji/candlestick"
+	"io"
+	"marlin/internal/atomicfile"
+	"os"
+	"path/filepath"
+)
+
+// settled indicator blocks are kept next to the candle store
+const cachePath = "./data/indicators"
+
+func blockPath(target candlestick.AssetIdentifier, interval int64, spec Spec, from int64) string {
+	return filepath.Join(cachePath, target.Broker, target.Exchange, target.Symbol,
+		fmt.Sprintf("%d", interval), spec.Key(), fmt.Sprintf("%d.gob", from))
+}
+
+// Cached returns the points stored for the block starting at from
+func Cached(target candlestick.AssetIdentifier, interval int64, spec Spec, from int64) ([]Point, bool, error) {
+	file, err := os.Open(blockPath(target, interval, spec, from))
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	defer file.Close()
+	points := make([]Point, 0)
+	if err = gob.NewDecoder(file).Decode(&points); err != nil {
+		return nil, false, err
+	}
+	return points, true, nil
+}
+
+// Cache stores the points of a block which will not change anymore
+func Cache(target candlestick.AssetIdentifier, interval int64, spec Spec, from int64, points []Point) error {
+	return atomicfile.WriteFile(blockPath(target, interval, spec, from), func(w io.Writer) error {
+		return gob.NewEncoder(w).Encode(points)
+	})
+}
@@ -0,0 +1,258 @@
+package indicators
+
+import (
+	"errors"
+	"fmt"
+	"github.com/godoji/candlestick"
+	"math"
+	"strconv"
+)
+
+// supported indicators
+const (
+	SMA       = "sma"
+	EMA       = "ema"
+	RSI       = "rsi"
+	ATR       = "atr"
+	VWAP      = "vwap" // rolling over period candles
+	Bollinger = "bollinger"
+)
+
+const maxPeriod = 500
+
+var defaultPeriods = map[string]int{
+	SMA:       20,
+	EMA:       20,
+	RSI:       14,
+	ATR:       14,
+	VWAP:      20,
+	Bollinger: 20,
+}
+
+var errInvalidName = errors.New("indicator must be sma, ema, rsi, atr, vwap or bollinger")
+var errInvalidPeriod = fmt.Errorf("period must be between 1 and %d", maxPeriod)
+var errInvalidDeviations = errors.New("k must be a positive number of standard deviations")
+
+// Spec selects an indicator, K is the width of Bollinger bands in standard deviations
+type Spec struct {
+	Name   string  `json:"name"`
+	Period int     `json:"period"`
+	K      float64 `json:"k,omitempty"`
+}
+
+// Point holds the indicator values at the time of a candle, values are null during
+// warm-up and for missing candles
+type Point struct {
+	Time   int64     `json:"time"`
+	Values []float64 `json:"values"`
+}
+
+func ParseSpec(name string, period string, k string) (Spec, error) {
+	spec := Spec{Name: name, Period: defaultPeriods[name]}
+	if spec.Period == 0 {
+		return spec, errInvalidName
+	}
+	if period != "" {
+		var err error
+		if spec.Period, err = strconv.Atoi(period); err != nil || spec.Period < 1 || spec.Period > maxPeriod {
+			return spec, errInvalidPeriod
+		}
+	}
+	if name == Bollinger {
+		spec.K = 2
+		if k != "" {
+			var err error
+			if spec.K, err = strconv.ParseFloat(k, 64); err != nil || spec.K <= 0 || math.IsInf(spec.K, 0) {
+				return spec, errInvalidDeviations
+			}
+		}
+	}
+	return spec, nil
+}
+
+// Key identifies the spec in cache paths
+func (s Spec) Key() string {
+	if s.Name == Bollinger {
+		return fmt.Sprintf("%s-%d-%s", s.Name, s.Period, strconv.FormatFloat(s.K, 'f', -1, 64))
+	}
+	return fmt.Sprintf("%s-%d", s.Name, s.Period)
+}
+
+// Columns names the values of each point
+func (s Spec) Columns() []string {
+	if s.Name == Bollinger {
+		return []string{"middle", "upper", "lower"}
+	}
+	return []string{s.Name}
+}
+
+// Warmup returns how many candles should precede the first point for its value to be
+// settled, smoothed indicators only approach their value so they get a longer run-up
+func (s Spec) Warmup() int {
+	switch s.Name {
+	case EMA:
+		return 5 * s.Period
+	case RSI, ATR:
+		return 10 * s.Period
+	default:
+		return s.Period - 1
+	}
+}
+
+// Compute returns a point for every candle, missing candles are skipped as if they
+// were not there and get no values
+func Compute(candles []candlestick.Candle, spec Spec) []Point {
+	next := stepper(spec)
+	points := make([]Point, len(candles))
+	for i, c := range candles {
+		points[i].Time = c.Time
+		if !c.Missing {
+			points[i].Values = next(c)
+		}
+	}
+	return points
+}
+
+// stepper returns a function which feeds a candle to the indicator and returns its
+// values, or nil while it is warming up
+func stepper(spec Spec) func(c candlestick.Candle) []float64 {
+	period := spec.Period
+	switch spec.Name {
+	case SMA:
+		w := newWindow(period)
+		return func(c candlestick.Candle) []float64 {
+			w.push(c.Close)
+			if !w.full() {
+				return nil
+			}
+			return []float64{w.sum / float64(period)}
+		}
+	case Bollinger:
+		w := newWindow(period)
+		return func(c candlestick.Candle) []float64 {
+			w.push(c.Close)
+			if !w.full() {
+				return nil
+			}
+			mean := w.sum / float64(period)
+			variance := 0.0
+			for _, v := range w.values {
+				variance += (v - mean) * (v - mean)
+			}
+			deviation := math.Sqrt(variance / float64(period))
+			return []float64{mean, mean + spec.K*deviation, mean - spec.K*deviation}
+		}
+	case VWAP:
+		prices := newWindow(period)
+		volumes := newWindow(period)
+		return func(c candlestick.Candle) []float64 {
+			prices.push((c.High + c.Low + c.Close) / 3 * c.Volume)
+			volumes.push(c.Volume)
+			if !volumes.full() || volumes.sum == 0 {
+				return nil
+			}
+			return []float64{prices.sum / volumes.sum}
+		}
+	case EMA:
+		// seeded with the average of the first period closes
+		seed := newWindow(period)
+		alpha := 2 / float64(period+1)
+		ema := 0.0
+		return func(c candlestick.Candle) []float64 {
+			if !seed.full() {
+				seed.push(c.Close)
+				if !seed.full() {
+					return nil
+				}
+				ema = seed.sum / float64(period)
+			} else {
+				ema += alpha * (c.Close - ema)
+			}
+			return []float64{ema}
+		}
+	case RSI:
+		gains := wilder(period)
+		losses := wilder(period)
+		previous := math.NaN()
+		return func(c candlestick.Candle) []float64 {
+			change := c.Close - previous
+			previous = c.Close
+			if math.IsNaN(change) {
+				return nil
+			}
+			gain, ok := gains(math.Max(change, 0))
+			loss, _ := losses(math.Max(-change, 0))
+			if !ok {
+				return nil
+			}
+			if loss == 0 {
+				if gain == 0 {
+					return []float64{50}
+				}
+				return []float64{100}
+			}
+			return []float64{100 - 100/(1+gain/loss)}
+		}
+	case ATR:
+		ranges := wilder(period)
+		previous := math.NaN()
+		return func(c candlestick.Candle) []float64 {
+			tr := c.High - c.Low
+			if !math.IsNaN(previous) {
+				tr = math.Max(tr, math.Max(math.Abs(c.High-previous), math.Abs(c.Low-previous)))
+			}
+			previous = c.Close
+			if atr, ok := ranges(tr); ok {
+				return []float64{atr}
+			}
+			return nil
+		}
+	default:
+		return func(c candlestick.Candle) []float64 { return nil }
+	}
+}
+
+// wilder returns Wilder's moving average, seeded with the mean of the first period values
+func wilder(period int) func(v float64) (float64, bool) {
+	seed := newWindow(period)
+	average := 0.0
+	return func(v float64) (float64, bool) {
+		if !seed.full() {
+			seed.push(v)
+			if !seed.full() {
+				return 0, false
+			}
+			average = seed.sum / float64(period)
+			return average, true
+		}
+		average = (average*float64(period-1) + v) / float64(period)
+		return average, true
+	}
+}
+
+// window keeps the last values pushed along with their sum
+type window struct {
+	values []float64
+	next   int
+	count  int
+	sum    float64
+}
+
+func newWindow(size int) *window {
+	return &window{values: make([]float64, size)}
+}
+
+func (w *window) push(v float64) {
+	if w.count == len(w.values) {
+		w.sum -= w.values[w.next]
+	} else {
+		w.count++
+	}
+	w.values[w.next] = v
+	w.sum += v
+	w.next = (w.next + 1) % len(w.values)
+}
+
+func (w *window) full() bool {
+	return w.count == len(w.values)
+}
@@ -0,0 +1,197 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"marlin/internal/tracing"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+	LevelFatal
+)
+
+var levelNames = map[Level]string{
+	LevelDebug: "debug",
+	LevelInfo:  "info",
+	LevelWarn:  "warn",
+	LevelError: "error",
+	LevelFatal: "fatal",
+}
+
+func (l Level) String() string {
+	return levelNames[l]
+}
+
+func ParseLevel(s string) (Level, bool) {
+	for level, name := range levelNames {
+		if strings.EqualFold(name, s) {
+			return level, true
+		}
+	}
+	return LevelInfo, false
+}
+
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// F creates a field, error values are logged by their message
+func F(key string, value interface{}) Field {
+	if err, ok := value.(error); ok && err != nil {
+		value = err.Error()
+	}
+	return Field{key, value}
+}
+
+type Logger struct {
+	fields []Field
+}
+
+var outputLock = sync.Mutex{}
+var output io.Writer = os.Stderr
+var minLevel = LevelInfo
+var useJSON = false
+
+// Setup configures the level and the output format of all loggers
+func Setup(level Level, asJSON bool) {
+	outputLock.Lock()
+	defer outputLock.Unlock()
+	minLevel = level
+	useJSON = asJSON
+}
+
+// With returns a logger which adds the fields to every entry
+func With(fields ...Field) *Logger {
+	return &Logger{fields: fields}
+}
+
+// Ctx returns a logger tagged with the request id of the context, if any
+func Ctx(ctx context.Context) *Logger {
+	if id := tracing.RequestId(ctx); id != "" {
+		return With(F("request_id", id))
+	}
+	return With()
+}
+
+func (l *Logger) With(fields ...Field) *Logger {
+	merged := make([]Field, 0, len(l.fields)+len(fields))
+	merged = append(merged, l.fields...)
+	merged = append(merged, fields...)
+	return &Logger{fields: merged}
+}
+
+func (l *Logger) Debug(msg string, fields ...Field) {
+	l.write(LevelDebug, msg, fields)
+}
+
+func (l *Logger) Info(msg string, fields ...Field) {
+	l.write(LevelInfo, msg, fields)
+}
+
+func (l *Logger) Warn(msg string, fields ...Field) {
+	l.write(LevelWarn, msg, fields)
+}
+
+func (l *Logger) Error(msg string, fields ...Field) {
+	l.write(LevelError, msg, fields)
+}
+
+// Fatal logs the entry and terminates the process
+func (l *Logger) Fatal(msg string, fields ...Field) {
+	l.write(LevelFatal, msg, fields)
+	os.Exit(1)
+}
+
+func (l *Logger) write(level Level, msg string, fields []Field) {
+	outputLock.Lock()
+	defer outputLock.Unlock()
+
+	if level < minLevel {
+		return
+	}
+
+	all := make([]Field, 0, len(l.fields)+len(fields))
+	all = append(all, l.fields...)
+	all = append(all, fields...)
+
+	now := time.Now().UTC().Format(time.RFC3339Nano)
+	var buf bytes.Buffer
+	if useJSON {
+		buf.WriteString(`{"time":`)
+		writeJSON(&buf, now)
+		buf.WriteString(`,"level":`)
+		writeJSON(&buf, level.String())
+		buf.WriteString(`,"msg":`)
+		writeJSON(&buf, msg)
+		for _, f := range all {
+			buf.WriteByte(',')
+			writeJSON(&buf, f.Key)
+			buf.WriteByte(':')
+			writeJSON(&buf, f.Value)
+		}
+		buf.WriteString("}\n")
+	} else {
+		buf.WriteString(now)
+		buf.WriteByte(' ')
+		buf.WriteString(fmt.Sprintf("%-5s", strings.ToUpper(level.String())))
+		buf.WriteByte(' ')
+		buf.WriteString(msg)
+		for _, f := range all {
+			buf.WriteByte(' ')
+			buf.WriteString(f.Key)
+			buf.WriteByte('=')
+			value := fmt.Sprint(f.Value)
+			if strings.ContainsAny(value, " \"=") {
+				value = fmt.Sprintf("%q", value)
+			}
+			buf.WriteString(value)
+		}
+		buf.WriteByte('\n')
+	}
+
+	_, _ = output.Write(buf.Bytes())
+}
+
+func writeJSON(buf *bytes.Buffer, value interface{}) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		data, _ = json.Marshal(fmt.Sprint(value))
+	}
+	buf.Write(data)
+}
+
+var root = &Logger{}
+
+func Debug(msg string, fields ...Field) {
+	root.write(LevelDebug, msg, fields)
+}
+
+func Info(msg string, fields ...Field) {
+	root.write(LevelInfo, msg, fields)
+}
+
+func Warn(msg string, fields ...Field) {
+	root.write(LevelWarn, msg, fields)
+}
+
+func Error(msg string, fields ...Field) {
+	root.write(LevelError, msg, fields)
+}
+
+func Fatal(msg string, fields ...Field) {
+	root.Fatal(msg, fields...)
+}
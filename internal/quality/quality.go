@@ -0,0 +1,99 @@
+package quality
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"github.com/godoji/candlestick"
+	"marlin/internal/logger"
+	"math"
+)
+
+// anomaly kinds
+const (
+	KindOHLC      = "ohlc"
+	KindVolume    = "volume"
+	KindOrder     = "order"
+	KindDuplicate = "duplicate"
+	KindSpike     = "spike"
+)
+
+// relative close-to-close change above which a candle is reported as a spike
+const spikeThreshold = 0.5
+
+var checkedCandles = expvar.NewInt("quality_candles_checked")
+var anomalyCount = expvar.NewMap("quality_anomalies")
+
+type Anomaly struct {
+	Time   int64  `json:"time"`
+	Kind   string `json:"kind"`
+	Detail string `json:"detail"`
+}
+
+// Check validates a series of candles and returns every anomaly found, placeholder
+// candles for missing data are skipped
+func Check(candles []candlestick.Candle) []Anomaly {
+	anomalies := make([]Anomaly, 0)
+	report := func(c candlestick.Candle, kind string, format string, args ...interface{}) {
+		anomalies = append(anomalies, Anomaly{Time: c.Time, Kind: kind, Detail: fmt.Sprintf(format, args...)})
+	}
+
+	seen := make(map[int64]bool, len(candles))
+	var last *candlestick.Candle
+	for i := range candles {
+		c := candles[i]
+
+		if seen[c.Time] {
+			report(c, KindDuplicate, "candle at %d occurs more than once", c.Time)
+			continue
+		}
+		seen[c.Time] = true
+
+		if last != nil && c.Time < last.Time {
+			report(c, KindOrder, "candle at %d follows candle at %d", c.Time, last.Time)
+		}
+
+		if c.Missing {
+			continue
+		}
+
+		if c.Low > c.High || c.Open < c.Low || c.Open > c.High || c.Close < c.Low || c.Close > c.High {
+			report(c, KindOHLC, "inconsistent prices o=%g h=%g l=%g c=%g", c.Open, c.High, c.Low, c.Close)
+		}
+		if c.Volume < 0 || c.TakerVolume < 0 || c.NumberOfTrades < 0 {
+			report(c, KindVolume, "negative volume v=%g tv=%g n=%d", c.Volume, c.TakerVolume, c.NumberOfTrades)
+		}
+		if last != nil && last.Close > 0 {
+			if change := math.Abs(c.Close-last.Close) / last.Close; change > spikeThreshold {
+				report(c, KindSpike, "close moved %.0f%% from %g to %g", change*100, last.Close, c.Close)
+			}
+		}
+
+		last = &candles[i]
+	}
+
+	return anomalies
+}
+
+// Validate checks candles of target, records the anomalies in the exported metrics
+// and logs them, the candles themselves are never modified
+func Validate(ctx context.Context, target candlestick.AssetIdentifier, candles []candlestick.Candle) []Anomaly {
+	anomalies := Check(candles)
+	checkedCandles.Add(int64(len(candles)))
+	if len(anomalies) == 0 {
+		return anomalies
+	}
+
+	kinds := make(map[string]int)
+	for _, a := range anomalies {
+		anomalyCount.Add(a.Kind, 1)
+		kinds[a.Kind]++
+	}
+	logger.Ctx(ctx).Warn("candle anomalies detected",
+		logger.F("symbol", target.ToString()),
+		logger.F("count", len(anomalies)),
+		logger.F("kinds", kinds),
+		logger.F("first", anomalies[0].Detail),
+	)
+	return anomalies
+}
@@ -0,0 +1,105 @@
+package quote
+
+import (
+	"github.com/godoji/candlestick"
+	"math"
+	"sort"
+	"strings"
+)
+
+// currencies treated as the US dollar, stablecoins are assumed to hold their peg
+var dollars = map[string]bool{
+	"USD":  true,
+	"USDT": true,
+	"USDC": true,
+	"BUSD": true,
+}
+
+// IsDollar reports whether currency is the US dollar or a dollar stablecoin
+func IsDollar(currency string) bool {
+	return dollars[strings.ToUpper(currency)]
+}
+
+// Rates are the prices of a currency in US dollars over time, a nil Rates is the dollar
+type Rates struct {
+	candles  []candlestick.Candle
+	interval int64
+	maxAge   int64
+}
+
+// NewRates keeps the non-missing candles of a price series with the given interval,
+// a rate is valid for maxAge seconds after its candle closed
+func NewRates(candles []candlestick.Candle, interval int64, maxAge int64) *Rates {
+	r := &Rates{candles: make([]candlestick.Candle, 0, len(candles)), interval: interval, maxAge: maxAge}
+	for _, c := range candles {
+		if !c.Missing {
+			r.candles = append(r.candles, c)
+		}
+	}
+	sort.Slice(r.candles, func(i, j int) bool { return r.candles[i].Time < r.candles[j].Time })
+	return r
+}
+
+// at returns the rates for a candle at t with the given interval as open, high, low
+// and close. A rate candle of the same period converts field by field, otherwise the
+// last known price is used without looking ahead: the open of a longer period still
+// running at t or the close of an earlier one.
+func (r *Rates) at(t int64, interval int64) ([4]float64, bool) {
+	if r == nil {
+		return [4]float64{1, 1, 1, 1}, true
+	}
+	i := sort.Search(len(r.candles), func(i int) bool { return r.candles[i].Time > t }) - 1
+	if i < 0 {
+		return [4]float64{}, false
+	}
+	c := r.candles[i]
+	switch {
+	case c.Time == t && r.interval == interval:
+		return [4]float64{c.Open, c.High, c.Low, c.Close}, true
+	case c.Time+r.interval > t:
+		return [4]float64{c.Open, c.Open, c.Open, c.Open}, true
+	case t-(c.Time+r.interval) <= r.maxAge:
+		return [4]float64{c.Close, c.Close, c.Close, c.Close}, true
+	default:
+		return [4]float64{}, false
+	}
+}
+
+// Converter converts candles quoted in one currency into another through the dollar
+type Converter struct {
+	From *Rates
+	To   *Rates
+}
+
+// Convert returns candles with prices and quote volume in the target currency, candles
+// without known rates become missing
+func (c *Converter) Convert(candles []candlestick.Candle, interval int64) []candlestick.Candle {
+	if c.From == nil && c.To == nil {
+		return candles
+	}
+	result := make([]candlestick.Candle, len(candles))
+	for i, candle := range candles {
+		if candle.Missing {
+			result[i] = candle
+			continue
+		}
+		from, okFrom := c.From.at(candle.Time, interval)
+		to, okTo := c.To.at(candle.Time, interval)
+		if !okFrom || !okTo || to[0] <= 0 || to[1] <= 0 || to[2] <= 0 || to[3] <= 0 {
+			result[i] = candlestick.Candle{Time: candle.Time, Missing: true}
+			continue
+		}
+		o := candle.Open * from[0] / to[0]
+		h := candle.High * from[1] / to[1]
+		l := candle.Low * from[2] / to[2]
+		cl := candle.Close * from[3] / to[3]
+		converted := candle
+		converted.Open = o
+		converted.High = math.Max(math.Max(h, l), math.Max(o, cl))
+		converted.Low = math.Min(math.Min(h, l), math.Min(o, cl))
+		converted.Close = cl
+		converted.TakerVolume = candle.TakerVolume * from[3] / to[3]
+		result[i] = converted
+	}
+	return result
+}
@@ -0,0 +1,83 @@
+package requests
+
+import (
+	"strconv"
+	"strings"
+)
+
+// mediaRange is one entry of an Accept header such as text/* or application/json;q=0.5
+type mediaRange struct {
+	kind    string
+	subtype string
+	q       float64
+}
+
+// parseAccept splits an Accept header into its media ranges, malformed entries are
+// skipped
+func parseAccept(accept string) []mediaRange {
+	ranges := make([]mediaRange, 0)
+	for _, part := range strings.Split(accept, ",") {
+		fields := strings.Split(part, ";")
+		kind, subtype, ok := strings.Cut(strings.ToLower(strings.TrimSpace(fields[0])), "/")
+		if !ok || kind == "" || subtype == "" || (kind == "*" && subtype != "*") {
+			continue
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			name, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if strings.ToLower(strings.TrimSpace(name)) != "q" {
+				continue
+			}
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil || parsed < 0 || parsed > 1 {
+				parsed = 0
+			}
+			q = parsed
+		}
+		ranges = append(ranges, mediaRange{kind: kind, subtype: subtype, q: q})
+	}
+	return ranges
+}
+
+// quality returns the q-value the most specific matching range gives to mime, zero
+// when no range matches
+func quality(ranges []mediaRange, mime string) float64 {
+	kind, subtype, _ := strings.Cut(mime, "/")
+	best, specificity := 0.0, -1
+	for _, r := range ranges {
+		s := -1
+		switch {
+		case r.kind == kind && r.subtype == subtype:
+			s = 2
+		case r.kind == kind && r.subtype == "*":
+			s = 1
+		case r.kind == "*":
+			s = 0
+		}
+		if s > specificity {
+			best, specificity = r.q, s
+		}
+	}
+	return best
+}
+
+// negotiateType picks the offer with the highest q-value in the Accept header, ties
+// go to the earlier offer. An empty header accepts the first offer, false means none
+// of the offers is acceptable.
+func negotiateType(accept string, offers []string) (string, bool) {
+	if len(offers) == 0 {
+		return "", false
+	}
+	if strings.TrimSpace(accept) == "" {
+		return offers[0], true
+	}
+
+	ranges := parseAccept(accept)
+	chosen, best := "", 0.0
+	for _, offer := range offers {
+		if q := quality(ranges, offer); q > best {
+			chosen, best = offer, q
+		}
+	}
+	return chosen, best > 0
+}
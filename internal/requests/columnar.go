@@ -0,0 +1,73 @@
+package requests
+
+import (
+	"encoding/binary"
+	"errors"
+	"github.com/godoji/candlestick"
+	"io"
+	"math"
+)
+
+// CandleSeries is implemented by payloads that can be sent in columnar form
+type CandleSeries interface {
+	CandleList() []candlestick.Candle
+}
+
+// SourcedSeries is implemented by series which can carry the sources of composite
+// candles, columnar and tabular formats have no room for them
+type SourcedSeries interface {
+	CandleSeries
+	HasSources() bool
+}
+
+var columnarMagic = [4]byte{'M', 'R', 'L', 'C'}
+
+const columnarVersion = uint32(1)
+
+// encodeColumnar writes candles as little-endian column arrays so clients can map
+// them directly onto numpy or arrow buffers. The layout is:
+//
+//	magic "MRLC" | version uint32 | count uint64
+//	time int64[count] | open float64[count] | high float64[count] | low float64[count]
+//	close float64[count] | volume float64[count] | takerVolume float64[count]
+//	numberOfTrades int64[count] | missing uint8[count]
+func encodeColumnar(w io.Writer, data interface{}) error {
+	series, ok := data.(CandleSeries)
+	if !ok {
+		return errors.New("payload can not be encoded as columns")
+	}
+	candles := series.CandleList()
+	n := len(candles)
+
+	buf := make([]byte, 16+n*(8*8+1))
+	copy(buf[0:], columnarMagic[:])
+	binary.LittleEndian.PutUint32(buf[4:], columnarVersion)
+	binary.LittleEndian.PutUint64(buf[8:], uint64(n))
+
+	columns := []func(c *candlestick.Candle) uint64{
+		func(c *candlestick.Candle) uint64 { return uint64(c.Time) },
+		func(c *candlestick.Candle) uint64 { return math.Float64bits(c.Open) },
+		func(c *candlestick.Candle) uint64 { return math.Float64bits(c.High) },
+		func(c *candlestick.Candle) uint64 { return math.Float64bits(c.Low) },
+		func(c *candlestick.Candle) uint64 { return math.Float64bits(c.Close) },
+		func(c *candlestick.Candle) uint64 { return math.Float64bits(c.Volume) },
+		func(c *candlestick.Candle) uint64 { return math.Float64bits(c.TakerVolume) },
+		func(c *candlestick.Candle) uint64 { return uint64(c.NumberOfTrades) },
+	}
+
+	offset := 16
+	for _, column := range columns {
+		for i := range candles {
+			binary.LittleEndian.PutUint64(buf[offset+i*8:], column(&candles[i]))
+		}
+		offset += n * 8
+	}
+	for i, c := range candles {
+		if c.Missing {
+			buf[offset+i] = 1
+		}
+	}
+
+	_, err := w.Write(buf)
+	return err
+}
@@ -0,0 +1,102 @@
+package requests
+
+import (
+	"compress/gzip"
+	"github.com/klauspost/compress/zstd"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	encodingGzip = "gzip"
+	encodingZstd = "zstd"
+)
+
+// preferred content encodings, best first
+var supportedEncodings = []string{encodingZstd, encodingGzip}
+
+// negotiateEncoding picks a content encoding from the Accept-Encoding header,
+// an empty string means the response is sent uncompressed. False means identity
+// was refused and none of the supported encodings is acceptable either.
+func negotiateEncoding(acceptEncoding string) (string, bool) {
+	if acceptEncoding == "" {
+		return "", true
+	}
+
+	accepted := make(map[string]bool)
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		fields := strings.Split(part, ";")
+		name := strings.ToLower(strings.TrimSpace(fields[0]))
+		if name == "" {
+			continue
+		}
+		allowed := true
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if !strings.HasPrefix(param, "q=") {
+				continue
+			}
+			q, err := strconv.ParseFloat(param[2:], 64)
+			if err != nil || q <= 0 {
+				allowed = false
+			}
+		}
+		accepted[name] = allowed
+	}
+
+	for _, encoding := range supportedEncodings {
+		if allowed, ok := accepted[encoding]; ok {
+			if allowed {
+				return encoding, true
+			}
+			continue
+		}
+		if accepted["*"] {
+			return encoding, true
+		}
+	}
+
+	// identity is acceptable unless refused by name or by a refused wildcard
+	if identity, ok := accepted["identity"]; ok {
+		return "", identity
+	}
+	if wildcard, ok := accepted["*"]; ok {
+		return "", wildcard
+	}
+	return "", true
+}
+
+// varyNegotiated marks a response as depending on the negotiation headers, so
+// shared caches keep the formats and encodings apart
+func varyNegotiated(w http.ResponseWriter) {
+	w.Header().Set("Vary", "Accept, Accept-Encoding")
+}
+
+// encodingAcceptable reports whether r accepts any content encoding we can send
+func encodingAcceptable(r *http.Request) bool {
+	_, ok := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+	return ok
+}
+
+// compressResponse wraps the response writer according to the negotiated content
+// encoding, the returned function must be called once the body has been written
+func compressResponse(w http.ResponseWriter, r *http.Request) (io.Writer, func()) {
+	encoding, _ := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+	switch encoding {
+	case encodingZstd:
+		encoder, err := zstd.NewWriter(w, zstd.WithEncoderLevel(zstd.SpeedFastest))
+		if err != nil {
+			return w, func() {}
+		}
+		w.Header().Set("Content-Encoding", encodingZstd)
+		return encoder, func() { _ = encoder.Close() }
+	case encodingGzip:
+		encoder := gzip.NewWriter(w)
+		w.Header().Set("Content-Encoding", encodingGzip)
+		return encoder, func() { _ = encoder.Close() }
+	default:
+		return w, func() {}
+	}
+}
@@ -0,0 +1,29 @@
+package requests
+
+import "testing"
+
+func TestNegotiateEncoding(t *testing.T) {
+	tests := []struct {
+		header   string
+		encoding string
+		ok       bool
+	}{
+		{header: "", encoding: "", ok: true},
+		{header: "gzip", encoding: encodingGzip, ok: true},
+		{header: "gzip, zstd", encoding: encodingZstd, ok: true},
+		{header: "zstd;q=0, gzip", encoding: encodingGzip, ok: true},
+		{header: "*", encoding: encodingZstd, ok: true},
+		{header: "br", encoding: "", ok: true},
+		{header: "br, identity;q=0", encoding: "", ok: false},
+		{header: "identity;q=0, gzip", encoding: encodingGzip, ok: true},
+		{header: "*;q=0", encoding: "", ok: false},
+		{header: "*;q=0, identity", encoding: "", ok: true},
+	}
+
+	for _, test := range tests {
+		encoding, ok := negotiateEncoding(test.header)
+		if encoding != test.encoding || ok != test.ok {
+			t.Errorf("negotiateEncoding(%q) = %q, %v, want %q, %v", test.header, encoding, ok, test.encoding, test.ok)
+		}
+	}
+}
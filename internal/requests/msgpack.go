@@ -0,0 +1,162 @@
+package requests
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// encodeMsgPack encodes a payload as MessagePack, field names follow the json tags
+// so both representations share the same schema
+func encodeMsgPack(w io.Writer, data interface{}) error {
+	out := bufio.NewWriter(w)
+	if err := writeMsgPack(out, reflect.ValueOf(data)); err != nil {
+		return err
+	}
+	return out.Flush()
+}
+
+func writeMsgPack(w *bufio.Writer, v reflect.Value) error {
+	var scratch [9]byte
+
+	if !v.IsValid() {
+		return w.WriteByte(0xc0)
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return w.WriteByte(0xc0)
+		}
+		return writeMsgPack(w, v.Elem())
+	case reflect.Bool:
+		if v.Bool() {
+			return w.WriteByte(0xc3)
+		}
+		return w.WriteByte(0xc2)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		scratch[0] = 0xd3
+		binary.BigEndian.PutUint64(scratch[1:], uint64(v.Int()))
+		_, err := w.Write(scratch[:9])
+		return err
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		scratch[0] = 0xcf
+		binary.BigEndian.PutUint64(scratch[1:], v.Uint())
+		_, err := w.Write(scratch[:9])
+		return err
+	case reflect.Float32:
+		scratch[0] = 0xca
+		binary.BigEndian.PutUint32(scratch[1:], math.Float32bits(float32(v.Float())))
+		_, err := w.Write(scratch[:5])
+		return err
+	case reflect.Float64:
+		scratch[0] = 0xcb
+		binary.BigEndian.PutUint64(scratch[1:], math.Float64bits(v.Float()))
+		_, err := w.Write(scratch[:9])
+		return err
+	case reflect.String:
+		s := v.String()
+		n := len(s)
+		switch {
+		case n < 32:
+			_ = w.WriteByte(0xa0 | byte(n))
+		case n <= math.MaxUint8:
+			_, _ = w.Write([]byte{0xd9, byte(n)})
+		case n <= math.MaxUint16:
+			scratch[0] = 0xda
+			binary.BigEndian.PutUint16(scratch[1:], uint16(n))
+			_, _ = w.Write(scratch[:3])
+		default:
+			scratch[0] = 0xdb
+			binary.BigEndian.PutUint32(scratch[1:], uint32(n))
+			_, _ = w.Write(scratch[:5])
+		}
+		_, err := w.WriteString(s)
+		return err
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return w.WriteByte(0xc0)
+		}
+		writeMsgPackHeader(w, v.Len(), 0x90, 0xdc, 0xdd)
+		for i := 0; i < v.Len(); i++ {
+			if err := writeMsgPack(w, v.Index(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Map:
+		if v.IsNil() {
+			return w.WriteByte(0xc0)
+		}
+		if v.Type().Key().Kind() != reflect.String {
+			return fmt.Errorf("unsupported message pack map key %s", v.Type().Key())
+		}
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+		writeMsgPackHeader(w, len(keys), 0x80, 0xde, 0xdf)
+		for _, key := range keys {
+			if err := writeMsgPack(w, key); err != nil {
+				return err
+			}
+			if err := writeMsgPack(w, v.MapIndex(key)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Struct:
+		t := v.Type()
+		names := make([]string, 0, t.NumField())
+		fields := make([]int, 0, t.NumField())
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			name := field.Name
+			if tag, ok := field.Tag.Lookup("json"); ok {
+				tagName := strings.Split(tag, ",")[0]
+				if tagName == "-" {
+					continue
+				}
+				if tagName != "" {
+					name = tagName
+				}
+			}
+			names = append(names, name)
+			fields = append(fields, i)
+		}
+		writeMsgPackHeader(w, len(fields), 0x80, 0xde, 0xdf)
+		for i, index := range fields {
+			if err := writeMsgPack(w, reflect.ValueOf(names[i])); err != nil {
+				return err
+			}
+			if err := writeMsgPack(w, v.Field(index)); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported message pack value %s", v.Type())
+	}
+}
+
+func writeMsgPackHeader(w *bufio.Writer, n int, fix byte, code16 byte, code32 byte) {
+	var scratch [5]byte
+	switch {
+	case n < 16:
+		_ = w.WriteByte(fix | byte(n))
+	case n <= math.MaxUint16:
+		scratch[0] = code16
+		binary.BigEndian.PutUint16(scratch[1:], uint16(n))
+		_, _ = w.Write(scratch[:3])
+	default:
+		scratch[0] = code32
+		binary.BigEndian.PutUint32(scratch[1:], uint32(n))
+		_, _ = w.Write(scratch[:5])
+	}
+}
@@ -1,54 +1,119 @@
 package requests
 
 import (
+	"bytes"
 	"encoding/gob"
 	"encoding/json"
+	"io"
+	"marlin/internal/logger"
 	"net/http"
-	"strings"
 )
 
-func sendAsJSON(w http.ResponseWriter, data interface{}) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	_ = json.NewEncoder(w).Encode(data)
+const (
+	MimeJSON     = "application/json"
+	MimeBinary   = "application/octet-stream"
+	MimeColumnar = "application/x-marlin-columnar"
+	MimeMsgPack  = "application/msgpack"
+)
+
+type encodeFunc = func(w io.Writer, data interface{}) error
+
+func encodeJSON(w io.Writer, data interface{}) error {
+	return json.NewEncoder(w).Encode(data)
 }
 
-func sendAsBinary(w http.ResponseWriter, data interface{}) {
-	w.Header().Set("Content-Type", "application/octet-stream")
-	w.WriteHeader(http.StatusOK)
-	_ = gob.NewEncoder(w).Encode(data)
+func encodeBinary(w io.Writer, data interface{}) error {
+	return gob.NewEncoder(w).Encode(data)
 }
 
-func SendResponse(w http.ResponseWriter, r *http.Request, data interface{}) {
+// legacy name of the message pack media type still sent by some clients
+const mimeMsgPackLegacy = "application/x-msgpack"
 
-	// try to satisfy accept header
-	accepts := r.Header.Get("Accept")
+// format is a response encoding offered for negotiation
+type format struct {
+	mime        string
+	contentType string
+	encode      encodeFunc
+	candlesOnly bool
+}
 
-	// send as json when nothing is specified
-	if accepts == "" {
-		sendAsJSON(w, data)
-		return
-	}
+// response formats in order of preference, json wins ties and wildcards
+var formats = []format{
+	{mime: MimeJSON, contentType: MimeJSON, encode: encodeJSON},
+	{mime: MimeBinary, contentType: MimeBinary, encode: encodeBinary},
+	{mime: MimeColumnar, contentType: MimeColumnar, encode: encodeColumnar, candlesOnly: true},
+	{mime: MimeCSV, contentType: MimeCSV, encode: encodeCSV, candlesOnly: true},
+	{mime: MimeParquet, contentType: MimeParquet, encode: encodeParquet, candlesOnly: true},
+	{mime: MimeMsgPack, contentType: MimeMsgPack, encode: encodeMsgPack},
+	{mime: mimeMsgPackLegacy, contentType: MimeMsgPack, encode: encodeMsgPack},
+}
 
-	// send as json when json is requested
-	if strings.Index(accepts, "application/json") != -1 {
-		sendAsJSON(w, data)
-		return
+// negotiateFormat picks the response format for the Accept header of r
+func negotiateFormat(r *http.Request, candles bool) (format, bool) {
+	offers := make([]string, 0, len(formats))
+	for _, f := range formats {
+		if candles || !f.candlesOnly {
+			offers = append(offers, f.mime)
+		}
 	}
+	mime, ok := negotiateType(r.Header.Get("Accept"), offers)
+	if !ok {
+		return format{}, false
+	}
+	for _, f := range formats {
+		if f.mime == mime {
+			return f, true
+		}
+	}
+	return format{}, false
+}
 
-	// send as gob when binary is requested
-	if strings.Index(accepts, "application/octet-stream") != -1 {
-		sendAsBinary(w, data)
+// send encodes data before the status is written, so an encoding failure can still
+// be reported as an error instead of a truncated 200
+func send(w http.ResponseWriter, r *http.Request, contentType string, encode encodeFunc, data interface{}) {
+	var body bytes.Buffer
+	if err := encode(&body, data); err != nil {
+		logger.Ctx(r.Context()).Error("failed encoding response", logger.F("contentType", contentType), logger.F("error", err))
+		http.Error(w, "unexpected error", http.StatusInternalServerError)
 		return
 	}
+	w.Header().Set("Content-Type", contentType)
+	out, finish := compressResponse(w, r)
+	w.WriteHeader(http.StatusOK)
+	_, _ = body.WriteTo(out)
+	finish()
+}
 
-	// send as json when any is requested
-	if strings.Index(accepts, "*/*") != -1 {
-		sendAsJSON(w, data)
+func SendResponse(w http.ResponseWriter, r *http.Request, data interface{}) {
+
+	// try to satisfy accept header, candle formats only apply to candle payloads which
+	// would not lose their sources
+	_, candles := data.(CandleSeries)
+	if sourced, ok := data.(SourcedSeries); ok && sourced.HasSources() {
+		candles = false
+	}
+	varyNegotiated(w)
+	f, ok := negotiateFormat(r, candles)
+	if !ok || !encodingAcceptable(r) {
+		// deny other types and encodings
+		w.WriteHeader(http.StatusNotAcceptable)
 		return
 	}
+	send(w, r, f.contentType, f.encode, data)
+}
 
-	// deny other types
-	w.WriteHeader(http.StatusNotAcceptable)
+// SendError sends an error body with the given status, unlike SendResponse it
+// never refuses the request but falls back to json
+func SendError(w http.ResponseWriter, r *http.Request, status int, data interface{}) {
+
+	f, ok := negotiateFormat(r, false)
+	if !ok {
+		f = formats[0]
+	}
 
+	varyNegotiated(w)
+	w.Header().Set("Content-Type", f.contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	_ = f.encode(w, data)
 }
@@ -0,0 +1,233 @@
+package requests
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"github.com/godoji/candlestick"
+	"github.com/xitongsys/parquet-go/writer"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+const (
+	MimeCSV     = "text/csv"
+	MimeParquet = "application/vnd.apache.parquet"
+)
+
+// header row of tabular exports, follows the field order of candlestick.Candle
+var csvHeader = []string{"Open", "High", "Low", "Close", "Volume", "TakerVolume", "NumberOfTrades", "Time", "Missing"}
+
+type parquetCandle struct {
+	Open           float64 `parquet:"name=Open, type=DOUBLE"`
+	High           float64 `parquet:"name=High, type=DOUBLE"`
+	Low            float64 `parquet:"name=Low, type=DOUBLE"`
+	Close          float64 `parquet:"name=Close, type=DOUBLE"`
+	Volume         float64 `parquet:"name=Volume, type=DOUBLE"`
+	TakerVolume    float64 `parquet:"name=TakerVolume, type=DOUBLE"`
+	NumberOfTrades int64   `parquet:"name=NumberOfTrades, type=INT64"`
+	Time           int64   `parquet:"name=Time, type=INT64"`
+	Missing        bool    `parquet:"name=Missing, type=BOOLEAN"`
+}
+
+func candleToRecord(c *candlestick.Candle) []string {
+	return []string{
+		strconv.FormatFloat(c.Open, 'f', -1, 64),
+		strconv.FormatFloat(c.High, 'f', -1, 64),
+		strconv.FormatFloat(c.Low, 'f', -1, 64),
+		strconv.FormatFloat(c.Close, 'f', -1, 64),
+		strconv.FormatFloat(c.Volume, 'f', -1, 64),
+		strconv.FormatFloat(c.TakerVolume, 'f', -1, 64),
+		strconv.FormatInt(c.NumberOfTrades, 10),
+		strconv.FormatInt(c.Time, 10),
+		strconv.FormatBool(c.Missing),
+	}
+}
+
+func encodeCSV(w io.Writer, data interface{}) error {
+	series, ok := data.(CandleSeries)
+	if !ok {
+		return errors.New("payload can not be encoded as csv")
+	}
+	stream := newCSVStream(w)
+	if err := stream.Write(series.CandleList()); err != nil {
+		return err
+	}
+	return stream.Close()
+}
+
+func encodeParquet(w io.Writer, data interface{}) error {
+	series, ok := data.(CandleSeries)
+	if !ok {
+		return errors.New("payload can not be encoded as parquet")
+	}
+	stream, err := newParquetStream(w)
+	if err != nil {
+		return err
+	}
+	if err = stream.Write(series.CandleList()); err != nil {
+		return err
+	}
+	return stream.Close()
+}
+
+// CandleWriter writes consecutive blocks of candles as a single table
+type CandleWriter interface {
+	Write(candles []candlestick.Candle) error
+	Close() error
+}
+
+// NewCandleWriter writes candles to w as "csv" or "parquet"
+func NewCandleWriter(w io.Writer, format string) (CandleWriter, error) {
+	switch format {
+	case "csv":
+		return newCSVStream(w), nil
+	case "parquet":
+		table, err := newParquetStream(w)
+		if err != nil {
+			return nil, err
+		}
+		return table, nil
+	default:
+		return nil, fmt.Errorf("unknown table format %q", format)
+	}
+}
+
+type csvStream struct {
+	writer        *csv.Writer
+	headerWritten bool
+}
+
+func newCSVStream(w io.Writer) *csvStream {
+	return &csvStream{writer: csv.NewWriter(w)}
+}
+
+func (s *csvStream) Write(candles []candlestick.Candle) error {
+	if !s.headerWritten {
+		s.headerWritten = true
+		if err := s.writer.Write(csvHeader); err != nil {
+			return err
+		}
+	}
+	for i := range candles {
+		if err := s.writer.Write(candleToRecord(&candles[i])); err != nil {
+			return err
+		}
+	}
+	s.writer.Flush()
+	return s.writer.Error()
+}
+
+func (s *csvStream) Close() error {
+	if !s.headerWritten {
+		return s.Write(nil)
+	}
+	return nil
+}
+
+type parquetStream struct {
+	writer *writer.ParquetWriter
+}
+
+func newParquetStream(w io.Writer) (*parquetStream, error) {
+	pw, err := writer.NewParquetWriterFromWriter(w, new(parquetCandle), 1)
+	if err != nil {
+		return nil, err
+	}
+	return &parquetStream{writer: pw}, nil
+}
+
+// Write appends the candles as a separate row group so memory stays bounded
+func (s *parquetStream) Write(candles []candlestick.Candle) error {
+	if len(candles) == 0 {
+		return nil
+	}
+	for _, c := range candles {
+		if err := s.writer.Write(parquetCandle(c)); err != nil {
+			return err
+		}
+	}
+	return s.writer.Flush(true)
+}
+
+func (s *parquetStream) Close() error {
+	return s.writer.WriteStop()
+}
+
+// CandleStream writes consecutive blocks of candles as a single response body,
+// the response header is only sent once the first block is written
+type CandleStream interface {
+	CandleWriter
+	Started() bool
+}
+
+type httpCandleStream struct {
+	w           http.ResponseWriter
+	r           *http.Request
+	contentType string
+	table       CandleWriter
+	finish      func()
+}
+
+func (s *httpCandleStream) start() error {
+	s.w.Header().Set("Content-Type", s.contentType)
+	out, finish := compressResponse(s.w, s.r)
+	s.w.WriteHeader(http.StatusOK)
+	s.finish = finish
+	if s.contentType == MimeParquet {
+		table, err := newParquetStream(out)
+		if err != nil {
+			return err
+		}
+		s.table = table
+	} else {
+		s.table = newCSVStream(out)
+	}
+	return nil
+}
+
+func (s *httpCandleStream) Started() bool {
+	return s.finish != nil
+}
+
+func (s *httpCandleStream) Write(candles []candlestick.Candle) error {
+	if !s.Started() {
+		if err := s.start(); err != nil {
+			return err
+		}
+	}
+	if err := s.table.Write(candles); err != nil {
+		return err
+	}
+	if flusher, ok := s.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return nil
+}
+
+func (s *httpCandleStream) Close() error {
+	if !s.Started() {
+		if err := s.start(); err != nil {
+			return err
+		}
+	}
+	defer s.finish()
+	if s.table == nil {
+		return nil
+	}
+	return s.table.Close()
+}
+
+// NewCandleStream negotiates a tabular format for a streaming export, csv is used
+// unless parquet is preferred. Returns false when no format or encoding is acceptable.
+func NewCandleStream(w http.ResponseWriter, r *http.Request) (CandleStream, bool) {
+
+	varyNegotiated(w)
+	contentType, ok := negotiateType(r.Header.Get("Accept"), []string{MimeCSV, MimeParquet})
+	if !ok || !encodingAcceptable(r) {
+		return nil, false
+	}
+
+	return &httpCandleStream{w: w, r: r, contentType: contentType}, true
+}
@@ -0,0 +1,79 @@
+package rpc
+
+import (
+	"context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"marlin/api/marlinpb"
+	"marlin/internal/auth"
+	"marlin/internal/throw"
+	"strconv"
+	"strings"
+)
+
+// methods which cost upstream weight or credits and count towards the daily quota
+var costlyMethods = map[string]bool{
+	marlinpb.Marlin_GetHistorical_FullMethodName:    true,
+	marlinpb.Marlin_GetLatest_FullMethodName:        true,
+	marlinpb.Marlin_SubscribeCandles_FullMethodName: true,
+}
+
+func apiKeyFromMetadata(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	if values := md.Get("x-api-key"); len(values) > 0 && values[0] != "" {
+		return values[0]
+	}
+	if values := md.Get("authorization"); len(values) > 0 && strings.HasPrefix(values[0], "Bearer ") {
+		return strings.TrimPrefix(values[0], "Bearer ")
+	}
+	return ""
+}
+
+// authenticate applies the same api key, rate limit and quota checks as the REST API,
+// the returned header tells rejected clients when to retry
+func authenticate(ctx context.Context, method string) (metadata.MD, error) {
+	if !auth.IsEnabled() {
+		return nil, nil
+	}
+
+	client, ok := auth.Lookup(apiKeyFromMetadata(ctx))
+	if !ok {
+		return nil, exceptionToStatus(throw.ErrUnauthorized)
+	}
+
+	reject := func(ex throw.Exception) (metadata.MD, error) {
+		return metadata.Pairs("retry-after", strconv.FormatInt(ex.RetryAfter, 10)), exceptionToStatus(ex)
+	}
+	if allowed, wait := client.Allow(); !allowed {
+		return reject(throw.ErrRateLimited.WithRetryAfter(wait))
+	}
+	if costlyMethods[method] {
+		if allowed, wait := client.Consume(); !allowed {
+			return reject(throw.ErrQuotaExceeded.WithRetryAfter(wait))
+		}
+	}
+	return nil, nil
+}
+
+func authUnary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if header, err := authenticate(ctx, info.FullMethod); err != nil {
+		if header != nil {
+			_ = grpc.SetHeader(ctx, header)
+		}
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func authStream(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if header, err := authenticate(ss.Context(), info.FullMethod); err != nil {
+		if header != nil {
+			_ = ss.SetHeader(header)
+		}
+		return err
+	}
+	return handler(srv, ss)
+}
@@ -0,0 +1,115 @@
+package rpc
+
+import (
+	"github.com/godoji/candlestick"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"marlin/api/marlinpb"
+	"marlin/internal/throw"
+)
+
+func candleToProto(c *candlestick.Candle) *marlinpb.Candle {
+	return &marlinpb.Candle{
+		Open:           c.Open,
+		High:           c.High,
+		Low:            c.Low,
+		Close:          c.Close,
+		Volume:         c.Volume,
+		TakerVolume:    c.TakerVolume,
+		NumberOfTrades: c.NumberOfTrades,
+		Time:           c.Time,
+		Missing:        c.Missing,
+	}
+}
+
+func candlesToProto(candles []candlestick.Candle) *marlinpb.CandlesResponse {
+	result := &marlinpb.CandlesResponse{Candles: make([]*marlinpb.Candle, len(candles))}
+	for i := range candles {
+		result.Candles[i] = candleToProto(&candles[i])
+	}
+	return result
+}
+
+func assetToProto(a *candlestick.AssetInfo) *marlinpb.AssetInfo {
+	result := &marlinpb.AssetInfo{
+		Symbol:             a.Symbol,
+		Pair:               a.Pair,
+		BaseAsset:          a.BaseAsset,
+		BaseAssetPrecision: int32(a.BaseAssetPrecision),
+		QuoteAsset:         a.QuoteAsset,
+		QuotePrecision:     int32(a.QuotePrecision),
+		Constraints: &marlinpb.TradeConstraints{
+			MaxPrice:     a.Constraints.MaxPrice,
+			MinPrice:     a.Constraints.MinPrice,
+			TickSize:     a.Constraints.TickSize,
+			MaxQuantity:  a.Constraints.MaxQuantity,
+			MinQuantity:  a.Constraints.MinQuantity,
+			StepSize:     a.Constraints.StepSize,
+			MaxNumOrders: int32(a.Constraints.MaxNumOrders),
+			MinNotional:  a.Constraints.MinNotional,
+		},
+		OnBoardDate: a.OnBoardDate,
+		Splits:      make([]*marlinpb.AssetSplit, len(a.Splits)),
+	}
+	if a.Identifier != nil {
+		result.Identifier = &marlinpb.AssetIdentifier{
+			Broker:   a.Identifier.Broker,
+			Exchange: a.Identifier.Exchange,
+			Symbol:   a.Identifier.Symbol,
+		}
+	}
+	for i, split := range a.Splits {
+		result.Splits[i] = &marlinpb.AssetSplit{Time: split.Time, Ratio: split.Ratio}
+	}
+	return result
+}
+
+func exchangeListToProto(list *candlestick.ExchangeList) *marlinpb.ExchangeList {
+	result := &marlinpb.ExchangeList{
+		Exchanges:  make([]*marlinpb.ExchangeInfo, len(list.Exchanges)),
+		BrokerInfo: make(map[string]*marlinpb.BrokerInfo),
+	}
+	for i, exchange := range list.Exchanges {
+		info := &marlinpb.ExchangeInfo{
+			Name:       exchange.Name,
+			ExchangeId: exchange.ExchangeId,
+			BrokerId:   exchange.BrokerId,
+			LastUpdate: exchange.LastUpdate,
+			Symbols:    make(map[string]*marlinpb.AssetInfo),
+			Resolution: exchange.Resolution,
+		}
+		for key, asset := range exchange.Symbols {
+			info.Symbols[key] = assetToProto(asset)
+		}
+		result.Exchanges[i] = info
+	}
+	for key, broker := range list.BrokerInfo {
+		result.BrokerInfo[key] = &marlinpb.BrokerInfo{Name: broker.Name}
+	}
+	return result
+}
+
+// exceptionToStatus maps exception kinds onto the gRPC status codes matching
+// the http status codes returned by throw.HttpError
+func exceptionToStatus(e throw.Exception) error {
+	switch e.Kind {
+	case throw.ErrKindUnavailable:
+		return status.Error(codes.Unavailable, e.Message)
+	case throw.ErrKindUserError:
+		return status.Error(codes.InvalidArgument, e.Message)
+	case throw.ErrKindNotImplemented:
+		return status.Error(codes.Unimplemented, e.Message)
+	case throw.ErrKindNotFound:
+		return status.Error(codes.NotFound, e.Message)
+	case throw.ErrKindUnauthorized:
+		return status.Error(codes.Unauthenticated, e.Message)
+	case throw.ErrKindRateLimited:
+		return status.Error(codes.ResourceExhausted, e.Message)
+	case throw.ErrKindCancelled:
+		return status.Error(codes.Canceled, e.Message)
+	case throw.ErrKindTimeout:
+		return status.Error(codes.DeadlineExceeded, e.Message)
+	default:
+		return status.Error(codes.Internal, e.Message)
+	}
+}
@@ -0,0 +1,166 @@
+package rpc
+
+import (
+	"context"
+	"github.com/godoji/candlestick"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"marlin/api/marlinpb"
+	"marlin/internal/arbiter"
+	"marlin/internal/config"
+	"marlin/internal/logger"
+	"marlin/internal/quality"
+	"marlin/internal/throw"
+	"net"
+	"time"
+)
+
+// how often subscriptions poll the upstream broker for new candles
+const subscribePollInterval = 10 * time.Second
+
+type server struct {
+	marlinpb.UnimplementedMarlinServer
+	// cancelled when the service shuts down, ends open subscriptions
+	ctx context.Context
+}
+
+// parseSymbol parses the symbol of a candle request, composite symbols are refused
+// since candle messages have no field for their sources
+func parseSymbol(s string) (candlestick.AssetIdentifier, error) {
+	target, ok := candlestick.ParseSymbol(s)
+	if !ok {
+		return nil, exceptionToStatus(throw.ErrInvalidSymbol)
+	}
+	if target.Broker == config.SourceComposite {
+		return nil, exceptionToStatus(throw.ErrCompositeNotSupported)
+	}
+	return target, nil
+}
+
+func (s *server) GetHistorical(ctx context.Context, req *marlinpb.GetHistoricalRequest) (*marlinpb.CandlesResponse, error) {
+	target, err := parseSymbol(req.Symbol)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := withDeadline(ctx, config.RouteHistorical)
+	defer cancel()
+	candles, ex := arbiter.FetchHistorical(ctx, target, req.From, req.Interval)
+	if ex != nil {
+		return nil, exceptionToStatus(ex)
+	}
+	quality.Validate(ctx, target, candles)
+	return candlesToProto(candles), nil
+}
+
+func (s *server) GetLatest(ctx context.Context, req *marlinpb.GetLatestRequest) (*marlinpb.CandlesResponse, error) {
+	target, err := parseSymbol(req.Symbol)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := withDeadline(ctx, config.RouteLatest)
+	defer cancel()
+	candles, ex := arbiter.FetchLatest(ctx, target, req.From)
+	if ex != nil {
+		return nil, exceptionToStatus(ex)
+	}
+	quality.Validate(ctx, target, candles)
+	return candlesToProto(candles), nil
+}
+
+func (s *server) GetExchangeInfo(_ context.Context, _ *marlinpb.GetExchangeInfoRequest) (*marlinpb.ExchangeList, error) {
+	return exchangeListToProto(arbiter.ExchangeInfo()), nil
+}
+
+func (s *server) SubscribeCandles(req *marlinpb.SubscribeCandlesRequest, stream marlinpb.Marlin_SubscribeCandlesServer) error {
+	target, err := parseSymbol(req.Symbol)
+	if err != nil {
+		return err
+	}
+
+	cursor := req.From
+	if cursor == 0 {
+		cursor = time.Now().UTC().Unix()
+	}
+
+	ticker := time.NewTicker(subscribePollInterval)
+	defer ticker.Stop()
+
+	for {
+		candles, ex := arbiter.FetchLatest(stream.Context(), target, cursor)
+		if ex != nil {
+			return exceptionToStatus(ex)
+		}
+
+		// only forward candles which are closed
+		now := time.Now().UTC().Unix()
+		for i := range candles {
+			c := &candles[i]
+			if c.Time < cursor || c.Time+candlestick.Interval1m > now {
+				continue
+			}
+			if err = stream.Send(candleToProto(c)); err != nil {
+				return err
+			}
+			cursor = c.Time + candlestick.Interval1m
+		}
+
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case <-s.ctx.Done():
+			return status.Error(codes.Unavailable, "server is shutting down")
+		case <-ticker.C:
+		}
+	}
+}
+
+// withDeadline applies the configured route deadline, a tighter deadline set by the
+// client still takes precedence
+func withDeadline(ctx context.Context, route string) (context.Context, context.CancelFunc) {
+	if d := config.ServiceConfig().Deadline(route); d > 0 {
+		return context.WithTimeout(ctx, d)
+	}
+	return context.WithCancel(ctx)
+}
+
+// Start serves the gRPC API until ctx is cancelled
+func Start(ctx context.Context) {
+
+	port := config.ServiceConfig().GrpcPort()
+	if port == "" {
+		return
+	}
+
+	listener, err := net.Listen("tcp", ":"+port)
+	if err != nil {
+		logger.Fatal("grpc could not listen", logger.F("port", port), logger.F("error", err))
+	}
+
+	s := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(traceUnary, authUnary),
+		grpc.ChainStreamInterceptor(traceStream, authStream),
+	)
+	marlinpb.RegisterMarlinServer(s, &server{ctx: ctx})
+
+	logger.Info("grpc listening", logger.F("port", port))
+
+	go func() {
+		<-ctx.Done()
+		stopped := make(chan struct{})
+		go func() {
+			s.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-time.After(config.ServiceConfig().ShutdownTimeout()):
+			s.Stop()
+		}
+	}()
+
+	if err = s.Serve(listener); err != nil {
+		logger.Fatal("grpc server stopped", logger.F("error", err))
+	}
+
+}
@@ -0,0 +1,48 @@
+package rpc
+
+import (
+	"context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"marlin/internal/tracing"
+)
+
+type tracedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *tracedStream) Context() context.Context {
+	return s.ctx
+}
+
+// traceContext attaches a valid request id sent by the client, or a new one, and opens
+// the root span of the call
+func traceContext(ctx context.Context, method string) (context.Context, func(err error)) {
+	id := ""
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("x-request-id"); len(values) > 0 {
+			id = values[0]
+		}
+	}
+	if !tracing.ValidRequestId(id) {
+		id = tracing.NewRequestId()
+	}
+	ctx = tracing.WithRequestId(ctx, id)
+	ctx, span := tracing.Start(ctx, "gRPC "+method)
+	return ctx, func(err error) { tracing.End(span, err) }
+}
+
+func traceUnary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, end := traceContext(ctx, info.FullMethod)
+	res, err := handler(ctx, req)
+	end(err)
+	return res, err
+}
+
+func traceStream(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, end := traceContext(ss.Context(), info.FullMethod)
+	err := handler(srv, &tracedStream{ss, ctx})
+	end(err)
+	return err
+}
@@ -0,0 +1,160 @@
+package store
+
+import (
+	"encoding/gob"
+	"fmt"
+	"github.com/godoji/candlestick"
+	"io"
+	"marlin/internal/atomicfile"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const storePath = "./data/candles"
+
+// candles are stored in chunks of this many candles aligned on the interval
+const chunkSize = candlestick.CandleSetSize
+
+var storeLock = sync.RWMutex{}
+
+func chunkPath(target candlestick.AssetIdentifier, interval int64, chunk int64) string {
+	return filepath.Join(storePath, target.Broker, target.Exchange, target.Symbol,
+		fmt.Sprintf("%d", interval), fmt.Sprintf("%d.gob", chunk))
+}
+
+func chunkOf(t int64, interval int64) int64 {
+	span := interval * chunkSize
+	if t < 0 {
+		return (t - span + 1) / span
+	}
+	return t / span
+}
+
+func readChunk(path string) ([]candlestick.Candle, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	candles := make([]candlestick.Candle, 0)
+	if err = gob.NewDecoder(file).Decode(&candles); err != nil {
+		return nil, fmt.Errorf("corrupt candle chunk %s: %w", path, err)
+	}
+	return candles, nil
+}
+
+// Put merges candles into the store, candles already stored for the same time are
+// replaced. Missing placeholders are not stored, they would hide the gap from Get and
+// overwrite candles which were stored before.
+func Put(target candlestick.AssetIdentifier, interval int64, candles []candlestick.Candle) error {
+	if interval <= 0 {
+		return fmt.Errorf("invalid interval %d", interval)
+	}
+
+	chunks := make(map[int64][]candlestick.Candle)
+	for _, c := range candles {
+		if c.Missing {
+			continue
+		}
+		chunk := chunkOf(c.Time, interval)
+		chunks[chunk] = append(chunks[chunk], c)
+	}
+
+	storeLock.Lock()
+	defer storeLock.Unlock()
+
+	for chunk, incoming := range chunks {
+		path := chunkPath(target, interval, chunk)
+		existing, err := readChunk(path)
+		if err != nil {
+			return err
+		}
+
+		merged := make(map[int64]candlestick.Candle, len(existing)+len(incoming))
+		for _, c := range existing {
+			merged[c.Time] = c
+		}
+		for _, c := range incoming {
+			merged[c.Time] = c
+		}
+		result := make([]candlestick.Candle, 0, len(merged))
+		for _, c := range merged {
+			result = append(result, c)
+		}
+		sort.Slice(result, func(i, j int) bool { return result[i].Time < result[j].Time })
+
+		err = atomicfile.WriteFile(path, func(w io.Writer) error {
+			return gob.NewEncoder(w).Encode(result)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Get returns the stored candles in [from, to), gaps are not stored so whether the
+// range is complete is up to the caller
+func Get(target candlestick.AssetIdentifier, interval int64, from int64, to int64) ([]candlestick.Candle, error) {
+	if interval <= 0 || to <= from {
+		return nil, fmt.Errorf("invalid range [%d, %d) with interval %d", from, to, interval)
+	}
+
+	storeLock.RLock()
+	defer storeLock.RUnlock()
+
+	candles := make([]candlestick.Candle, 0)
+	for chunk := chunkOf(from, interval); chunk <= chunkOf(to-1, interval); chunk++ {
+		stored, err := readChunk(chunkPath(target, interval, chunk))
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range stored {
+			if c.Time >= from && c.Time < to && !c.Missing {
+				candles = append(candles, c)
+			}
+		}
+	}
+	return candles, nil
+}
+
+// GetAll returns every stored candle of target with the given interval
+func GetAll(target candlestick.AssetIdentifier, interval int64) ([]candlestick.Candle, error) {
+	storeLock.RLock()
+	defer storeLock.RUnlock()
+
+	dir := filepath.Dir(chunkPath(target, interval, 0))
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return []candlestick.Candle{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	chunks := make([]int64, 0, len(entries))
+	for _, entry := range entries {
+		chunk, err := strconv.ParseInt(strings.TrimSuffix(entry.Name(), ".gob"), 10, 64)
+		if err == nil && strings.HasSuffix(entry.Name(), ".gob") {
+			chunks = append(chunks, chunk)
+		}
+	}
+	sort.Slice(chunks, func(i, j int) bool { return chunks[i] < chunks[j] })
+
+	candles := make([]candlestick.Candle, 0)
+	for _, chunk := range chunks {
+		stored, err := readChunk(chunkPath(target, interval, chunk))
+		if err != nil {
+			return nil, err
+		}
+		candles = append(candles, stored...)
+	}
+	return candles, nil
+}
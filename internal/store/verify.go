@@ -0,0 +1,116 @@
+package store
+
+import (
+	"encoding/gob"
+	"fmt"
+	"github.com/godoji/candlestick"
+	"io"
+	"marlin/internal/atomicfile"
+	"marlin/internal/quality"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Problem is an issue found in a chunk of the candle store, warnings are suspicious
+// data which may as well be genuine
+type Problem struct {
+	Path     string
+	Message  string
+	Repaired bool
+	Warning  bool
+}
+
+// Verify checks every chunk in the store, corrupt chunks are removed and misplaced,
+// duplicate or unsorted candles are fixed when repair is set. Price anomalies are
+// reported but never repaired.
+func Verify(repair bool) (chunks int, problems []Problem, err error) {
+	storeLock.Lock()
+	defer storeLock.Unlock()
+
+	problems = make([]Problem, 0)
+	err = filepath.Walk(storePath, func(path string, info os.FileInfo, err error) error {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil || info.IsDir() || !strings.HasSuffix(path, ".gob") {
+			return err
+		}
+		chunks++
+
+		// layout is broker/exchange/symbol/interval/chunk.gob
+		parts := strings.Split(filepath.ToSlash(strings.TrimPrefix(path, filepath.Clean(storePath)+string(filepath.Separator))), "/")
+		interval, intervalErr := strconv.ParseInt(parts[len(parts)-2], 10, 64)
+		chunk, chunkErr := strconv.ParseInt(strings.TrimSuffix(parts[len(parts)-1], ".gob"), 10, 64)
+		if len(parts) != 5 || intervalErr != nil || chunkErr != nil || interval <= 0 {
+			problems = append(problems, Problem{Path: path, Message: "unexpected file in store"})
+			return nil
+		}
+
+		candles, readErr := readChunk(path)
+		if readErr != nil {
+			p := Problem{Path: path, Message: readErr.Error()}
+			if repair {
+				p.Repaired = os.Remove(path) == nil
+			}
+			problems = append(problems, p)
+			return nil
+		}
+
+		fixed, messages := checkChunk(candles, interval, chunk)
+		if len(messages) > 0 {
+			repaired := false
+			if repair {
+				repaired = atomicfile.WriteFile(path, func(w io.Writer) error {
+					return gob.NewEncoder(w).Encode(fixed)
+				}) == nil
+			}
+			for _, m := range messages {
+				problems = append(problems, Problem{Path: path, Message: m, Repaired: repaired})
+			}
+		}
+
+		for _, a := range quality.Check(fixed) {
+			if a.Kind != quality.KindOrder && a.Kind != quality.KindDuplicate {
+				problems = append(problems, Problem{Path: path, Message: fmt.Sprintf("%s anomaly: %s", a.Kind, a.Detail), Warning: true})
+			}
+		}
+		return nil
+	})
+	return chunks, problems, err
+}
+
+// checkChunk returns the chunk's candles sorted, unique and within the chunk along
+// with a message for every kind of fix applied
+func checkChunk(candles []candlestick.Candle, interval int64, chunk int64) ([]candlestick.Candle, []string) {
+	messages := make([]string, 0)
+
+	fixed := make([]candlestick.Candle, 0, len(candles))
+	seen := make(map[int64]bool, len(candles))
+	misplaced, duplicates := 0, 0
+	for _, c := range candles {
+		if chunkOf(c.Time, interval) != chunk || c.Time%interval != 0 {
+			misplaced++
+			continue
+		}
+		if seen[c.Time] {
+			duplicates++
+			continue
+		}
+		seen[c.Time] = true
+		fixed = append(fixed, c)
+	}
+	if misplaced > 0 {
+		messages = append(messages, fmt.Sprintf("%d candles outside of chunk", misplaced))
+	}
+	if duplicates > 0 {
+		messages = append(messages, fmt.Sprintf("%d duplicate candles", duplicates))
+	}
+	if !sort.SliceIsSorted(fixed, func(i, j int) bool { return fixed[i].Time < fixed[j].Time }) {
+		sort.Slice(fixed, func(i, j int) bool { return fixed[i].Time < fixed[j].Time })
+		messages = append(messages, "candles out of order")
+	}
+	return fixed, messages
+}
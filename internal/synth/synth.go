@@ -0,0 +1,106 @@
+package synth
+
+import (
+	"errors"
+	"github.com/godoji/candlestick"
+	"marlin/internal/config"
+	"math"
+	"sort"
+	"strings"
+)
+
+// synthetic instrument kinds, used as exchange of SYNTH identifiers
+const (
+	KindRatio  = "RATIO"  // SYNTH:RATIO:BINANCE.SPOT.ETHUSDT/BINANCE.SPOT.BTCUSDT
+	KindSpread = "SPREAD" // SYNTH:SPREAD:BINANCE.PERP.BTCUSDT/BINANCE.SPOT.BTCUSDT
+	KindBasis  = "BASIS"  // SYNTH:BASIS:BTCUSDT, the spread of a Binance perpetual over spot
+)
+
+var errInvalidInstrument = errors.New("synthetic instruments are RATIO or SPREAD of two legs BROKER.EXCHANGE.SYMBOL separated by a slash, or BASIS of a Binance symbol")
+
+// Instrument is derived from two legs, ratios divide the first leg by the second and
+// spreads subtract the second leg from the first
+type Instrument struct {
+	Kind string
+	Legs [2]candlestick.AssetIdentifier
+}
+
+func Parse(target candlestick.AssetIdentifier) (*Instrument, error) {
+	switch target.Exchange {
+	case KindBasis:
+		if target.Symbol == "" || strings.ContainsAny(target.Symbol, "./") {
+			return nil, errInvalidInstrument
+		}
+		return &Instrument{Kind: KindSpread, Legs: [2]candlestick.AssetIdentifier{
+			candlestick.NewAssetIdentifier(config.SourceBinance, "PERP", target.Symbol),
+			candlestick.NewAssetIdentifier(config.SourceBinance, "SPOT", target.Symbol),
+		}}, nil
+	case KindRatio, KindSpread:
+		legs := strings.Split(target.Symbol, "/")
+		if len(legs) != 2 {
+			return nil, errInvalidInstrument
+		}
+		instrument := &Instrument{Kind: target.Exchange}
+		for i, leg := range legs {
+			parts := strings.SplitN(leg, ".", 3)
+			if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" || parts[0] == config.SourceSynth {
+				return nil, errInvalidInstrument
+			}
+			instrument.Legs[i] = candlestick.NewAssetIdentifier(parts[0], parts[1], parts[2])
+		}
+		return instrument, nil
+	default:
+		return nil, errInvalidInstrument
+	}
+}
+
+// Combine aligns the candles of both legs on their timestamps and derives a synthetic
+// candle for every time either leg has, times missing from a leg are missing. Highs
+// and lows are approximated from the highs and lows of the legs, synthetic candles
+// carry no volume.
+func (s *Instrument) Combine(first []candlestick.Candle, second []candlestick.Candle) []candlestick.Candle {
+	seconds := make(map[int64]candlestick.Candle, len(second))
+	times := make([]int64, 0, len(first)+len(second))
+	for _, c := range second {
+		seconds[c.Time] = c
+		times = append(times, c.Time)
+	}
+	firsts := make(map[int64]candlestick.Candle, len(first))
+	for _, c := range first {
+		firsts[c.Time] = c
+		if _, ok := seconds[c.Time]; !ok {
+			times = append(times, c.Time)
+		}
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i] < times[j] })
+
+	result := make([]candlestick.Candle, 0, len(times))
+	for _, t := range times {
+		a, okA := firsts[t]
+		b, okB := seconds[t]
+		if !okA || !okB || a.Missing || b.Missing {
+			result = append(result, candlestick.Candle{Time: t, Missing: true})
+			continue
+		}
+		result = append(result, s.combine(a, b))
+	}
+	return result
+}
+
+func (s *Instrument) combine(a candlestick.Candle, b candlestick.Candle) candlestick.Candle {
+	op := func(x float64, y float64) float64 { return x - y }
+	if s.Kind == KindRatio {
+		if b.Open <= 0 || b.High <= 0 || b.Low <= 0 || b.Close <= 0 {
+			return candlestick.Candle{Time: a.Time, Missing: true}
+		}
+		op = func(x float64, y float64) float64 { return x / y }
+	}
+	o, h, l, c := op(a.Open, b.Open), op(a.High, b.High), op(a.Low, b.Low), op(a.Close, b.Close)
+	return candlestick.Candle{
+		Open:  o,
+		High:  math.Max(math.Max(h, l), math.Max(o, c)),
+		Low:   math.Min(math.Min(h, l), math.Min(o, c)),
+		Close: c,
+		Time:  a.Time,
+	}
+}
@@ -1,6 +1,13 @@
 package throw
 
-import "net/http"
+import (
+	"context"
+	"marlin/internal/logger"
+	"marlin/internal/requests"
+	"net/http"
+	"strconv"
+	"time"
+)
 
 type ExceptionKind = int
 
@@ -10,45 +17,197 @@ const (
 	ErrKindUnavailable
 	ErrKindNotImplemented
 	ErrKindNotFound
+	ErrKindUnauthorized
+	ErrKindRateLimited
+	ErrKindCancelled
+	ErrKindTimeout
 )
 
+// StatusClientClosedRequest is the non standard status logged when the client
+// went away before the response was ready
+const StatusClientClosedRequest = 499
+
+// codes used for exceptions created from arbitrary errors
+var kindCodes = map[ExceptionKind]string{
+	ErrKindUnexpected:     "UNEXPECTED",
+	ErrKindUserError:      "USER_ERROR",
+	ErrKindUnavailable:    "UNAVAILABLE",
+	ErrKindNotImplemented: "NOT_IMPLEMENTED",
+	ErrKindNotFound:       "NOT_FOUND",
+	ErrKindUnauthorized:   "UNAUTHORIZED",
+	ErrKindRateLimited:    "RATE_LIMITED",
+	ErrKindCancelled:      "CANCELLED",
+	ErrKindTimeout:        "TIMEOUT",
+}
+
+// client visible messages of exceptions created from arbitrary errors, upstream
+// errors can hold urls with credentials so they are only logged
+var kindMessages = map[ExceptionKind]string{
+	ErrKindUnexpected:     "unexpected error",
+	ErrKindUserError:      "invalid request",
+	ErrKindUnavailable:    "service unavailable",
+	ErrKindNotImplemented: "not implemented",
+	ErrKindNotFound:       "resource not found",
+	ErrKindUnauthorized:   "unauthorized",
+	ErrKindRateLimited:    "rate limited",
+	ErrKindCancelled:      "request cancelled",
+	ErrKindTimeout:        "request timed out",
+}
+
 type exceptionStruct struct {
-	Message string        `json:"message"`
-	Kind    ExceptionKind `json:"unexpected"`
+	Code       string        `json:"code"`
+	Message    string        `json:"message"`
+	Kind       ExceptionKind `json:"kind"`
+	RequestId  string        `json:"requestId,omitempty"`
+	RetryAfter int64         `json:"retryAfter,omitempty"`
+	Broker     string        `json:"broker,omitempty"`
+	cause      error
 }
 
 type Exception = *exceptionStruct
 
+// errorEnvelope is the body of every error response
+type errorEnvelope struct {
+	Error exceptionStruct `json:"error"`
+}
+
+func (e *exceptionStruct) Error() string {
+	if e.cause != nil && e.cause.Error() != e.Message {
+		return e.Message + ": " + e.cause.Error()
+	}
+	return e.Message
+}
+
+func (e *exceptionStruct) Unwrap() error {
+	return e.cause
+}
+
+// WithBroker returns a copy of the exception attributed to an upstream broker
+func (e *exceptionStruct) WithBroker(broker string) Exception {
+	c := *e
+	c.Broker = broker
+	return &c
+}
+
+// WithRetryAfter returns a copy of the exception hinting when to try again
+func (e *exceptionStruct) WithRetryAfter(wait time.Duration) Exception {
+	c := *e
+	c.RetryAfter = int64(wait.Seconds() + 0.999)
+	if c.RetryAfter < 1 {
+		c.RetryAfter = 1
+	}
+	return &c
+}
+
+// New creates an exception from an error, the error is kept as cause for the logs
+// and clients only see the generic message of kind
 func New(err error, kind ExceptionKind) Exception {
-	return &exceptionStruct{err.Error(), kind}
+	return &exceptionStruct{Code: kindCodes[kind], Message: kindMessages[kind], Kind: kind, cause: err}
+}
+
+// FromContext returns the exception matching a done context, or nil while the
+// context is still active
+func FromContext(ctx context.Context) Exception {
+	switch ctx.Err() {
+	case nil:
+		return nil
+	case context.DeadlineExceeded:
+		return Wrap(ctx.Err(), ErrDeadlineExceeded)
+	default:
+		return Wrap(ctx.Err(), ErrRequestCancelled)
+	}
+}
+
+// Wrap returns a copy of a predefined exception caused by err
+func Wrap(err error, e Exception) Exception {
+	c := *e
+	c.cause = err
+	return &c
+}
+
+func newException(code string, message string, kind ExceptionKind) Exception {
+	return &exceptionStruct{Code: code, Message: message, Kind: kind}
 }
 
-var ErrUnhandled = &exceptionStruct{"unexpected error", ErrKindUnexpected}
-var ErrWIP = &exceptionStruct{"work in progress", ErrKindNotImplemented}
-var ErrNotAvailable = &exceptionStruct{"source does not has requested data", ErrKindNotImplemented}
-var ErrInvalidSymbol = &exceptionStruct{"invalid symbol formatting", ErrKindUserError}
-var ErrInvalidSource = &exceptionStruct{"invalid data source", ErrKindUserError}
-var ErrInvalidExchange = &exceptionStruct{"invalid exchange", ErrKindUserError}
-var ErrInvalidInterval = &exceptionStruct{"invalid interval", ErrKindUserError}
-var ErrIntervalNotSupported = &exceptionStruct{"interval not supported", ErrKindUserError}
-var ErrSourceNotSupported = &exceptionStruct{"not supported", ErrKindUserError}
-var ErrInvalidFromParameter = &exceptionStruct{"parameter from is required for exchange", ErrKindUserError}
+var ErrUnhandled = newException("UNHANDLED", "unexpected error", ErrKindUnexpected)
+var ErrWIP = newException("WORK_IN_PROGRESS", "work in progress", ErrKindNotImplemented)
+var ErrNotAvailable = newException("NOT_AVAILABLE", "source does not has requested data", ErrKindNotImplemented)
+var ErrInvalidSymbol = newException("INVALID_SYMBOL", "invalid symbol formatting", ErrKindUserError)
+var ErrInvalidSource = newException("INVALID_SOURCE", "invalid data source", ErrKindUserError)
+var ErrInvalidExchange = newException("INVALID_EXCHANGE", "invalid exchange", ErrKindUserError)
+var ErrInvalidInterval = newException("INVALID_INTERVAL", "invalid interval", ErrKindUserError)
+var ErrIntervalNotSupported = newException("INTERVAL_NOT_SUPPORTED", "interval not supported", ErrKindUserError)
+var ErrSourceNotSupported = newException("SOURCE_NOT_SUPPORTED", "not supported", ErrKindUserError)
+var ErrInvalidFromParameter = newException("INVALID_FROM", "parameter from is required for exchange", ErrKindUserError)
+var ErrUnauthorized = newException("UNAUTHORIZED", "missing or invalid api key", ErrKindUnauthorized)
+var ErrRateLimited = newException("RATE_LIMITED", "rate limit exceeded", ErrKindRateLimited)
+var ErrQuotaExceeded = newException("QUOTA_EXCEEDED", "daily quota exceeded", ErrKindRateLimited)
+var ErrNotFound = newException("NOT_FOUND", "resource not found", ErrKindNotFound)
+var ErrRequestCancelled = newException("CANCELLED", "request cancelled", ErrKindCancelled)
+var ErrDeadlineExceeded = newException("DEADLINE_EXCEEDED", "request deadline exceeded", ErrKindTimeout)
+var ErrInvalidToParameter = newException("INVALID_TO", "parameter to must be a timestamp after from", ErrKindUserError)
+var ErrNotStored = newException("NOT_STORED", "requested candles are not in the local store", ErrKindUnavailable)
+var ErrOffline = newException("OFFLINE", "not available in offline mode", ErrKindUnavailable)
+var ErrInvalidLimit = newException("INVALID_LIMIT", "parameter limit must be between 1 and 5000", ErrKindUserError)
+var ErrInvalidFuturesDepthLimit = newException("INVALID_LIMIT", "parameter limit must be 5, 10, 20, 50, 100, 500 or 1000 for futures", ErrKindUserError)
+var ErrInvalidAtParameter = newException("INVALID_AT", "parameter at must be a timestamp", ErrKindUserError)
+var ErrNoDepthRecorded = newException("NO_DEPTH_RECORDED", "no order book was recorded at or before the requested time", ErrKindNotFound)
+var ErrInvalidFromIdParameter = newException("INVALID_FROM_ID", "parameter fromId must be a trade id", ErrKindUserError)
+var ErrInvalidBars = newException("INVALID_BARS", "invalid bar type or size", ErrKindUserError)
+var ErrTooManyTrades = newException("TOO_MANY_TRADES", "too many trades in range, request a shorter range", ErrKindUserError)
+var ErrInvalidIndicator = newException("INVALID_INDICATOR", "invalid indicator or indicator parameters", ErrKindUserError)
+var ErrInvalidQuote = newException("INVALID_QUOTE", "parameter quote must be a currency code", ErrKindUserError)
+var ErrQuoteNotSupported = newException("QUOTE_NOT_SUPPORTED", "no rates to convert into the requested currency", ErrKindUserError)
+var ErrCompositeNotSupported = newException("COMPOSITE_NOT_SUPPORTED", "composite candles are only served by routes which report their sources", ErrKindUserError)
+var ErrNoTargets = newException("NO_TARGETS", "job does not match any symbol", ErrKindUserError)
+var ErrInvalidJob = newException("INVALID_JOB", "invalid job specification", ErrKindUserError)
 
-func HttpError(w http.ResponseWriter, e Exception) {
+func StatusCode(e Exception) int {
 	switch e.Kind {
 	case ErrKindUnavailable:
-		http.Error(w, e.Message, http.StatusServiceUnavailable)
+		return http.StatusServiceUnavailable
 	case ErrKindUserError:
-		http.Error(w, e.Message, http.StatusBadRequest)
+		return http.StatusBadRequest
 	case ErrKindNotImplemented:
-		http.Error(w, e.Message, http.StatusNotImplemented)
+		return http.StatusNotImplemented
+	case ErrKindUnauthorized:
+		return http.StatusUnauthorized
+	case ErrKindRateLimited:
+		return http.StatusTooManyRequests
 	case ErrKindNotFound:
-		http.Error(w, e.Message, http.StatusMethodNotAllowed)
+		return http.StatusNotFound
+	case ErrKindCancelled:
+		return StatusClientClosedRequest
+	case ErrKindTimeout:
+		return http.StatusGatewayTimeout
 	default:
-		http.Error(w, e.Message, http.StatusInternalServerError)
+		return http.StatusInternalServerError
 	}
 }
 
+func HttpError(w http.ResponseWriter, r *http.Request, e Exception) {
+	status := StatusCode(e)
+
+	body := *e
+	body.RequestId = r.Header.Get("X-Request-Id")
+
+	if status >= http.StatusInternalServerError {
+		logger.Ctx(r.Context()).Error("request failed",
+			logger.F("method", r.Method),
+			logger.F("path", r.URL.Path),
+			logger.F("code", e.Code),
+			logger.F("broker", e.Broker),
+			logger.F("error", e.Error()),
+		)
+	}
+
+	if e.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.FormatInt(e.RetryAfter, 10))
+	}
+
+	requests.SendError(w, r, status, errorEnvelope{body})
+}
+
 func HttpNotImplemented(w http.ResponseWriter) {
 	w.WriteHeader(http.StatusNotImplemented)
 }
@@ -0,0 +1,106 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+	"regexp"
+	"strings"
+)
+
+const serviceName = "marlin"
+
+type requestIdKey struct{}
+
+var tracer = otel.Tracer(serviceName)
+
+// NewRequestId returns a random identifier used to correlate logs of one request
+func NewRequestId() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+var requestIdPattern = regexp.MustCompile(`^[A-Za-z0-9-]{1,64}$`)
+
+// ValidRequestId reports whether a request id sent by a client is safe to copy into
+// logs and responses
+func ValidRequestId(id string) bool {
+	return requestIdPattern.MatchString(id)
+}
+
+func WithRequestId(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIdKey{}, id)
+}
+
+// RequestId returns the request id stored in the context, empty for background work
+func RequestId(ctx context.Context) string {
+	if id, ok := ctx.Value(requestIdKey{}).(string); ok {
+		return id
+	}
+	return ""
+}
+
+// Start opens a span, the request id is attached so traces can be found from logs
+func Start(ctx context.Context, name string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	if id := RequestId(ctx); id != "" {
+		attributes = append(attributes, attribute.String("request.id", id))
+	}
+	return tracer.Start(ctx, name, trace.WithAttributes(attributes...))
+}
+
+// End closes the span and records the error if any
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Setup installs the trace exporter, endpoint is either empty to disable
+// tracing, "stdout" or the url of an OTLP/HTTP collector. The returned function
+// flushes pending spans.
+func Setup(endpoint string) (func(ctx context.Context), error) {
+
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	if endpoint == "" {
+		return func(ctx context.Context) {}, nil
+	}
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	if endpoint == "stdout" {
+		exporter, err = stdouttrace.New(stdouttrace.WithPrettyPrint())
+	} else {
+		options := []otlptracehttp.Option{otlptracehttp.WithEndpoint(strings.TrimPrefix(strings.TrimPrefix(endpoint, "http://"), "https://"))}
+		if !strings.HasPrefix(endpoint, "https://") {
+			options = append(options, otlptracehttp.WithInsecure())
+		}
+		exporter, err = otlptracehttp.New(context.Background(), options...)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(serviceName))),
+	)
+	otel.SetTracerProvider(provider)
+
+	return func(ctx context.Context) {
+		_ = provider.Shutdown(ctx)
+	}, nil
+}
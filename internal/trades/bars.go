@@ -0,0 +1,130 @@
+package trades
+
+import (
+	"errors"
+	"github.com/godoji/candlestick"
+	"strconv"
+)
+
+// bar types
+const (
+	BarTick   = "tick"   // a bar every size trades
+	BarVolume = "volume" // a bar every size base asset traded
+	BarDollar = "dollar" // a bar every size quote asset traded
+	BarTime   = "time"   // a bar every size seconds
+)
+
+// maximum size of time bars, longer bars are served from klines
+const maxTimeBarSize = 3600
+
+type BarSpec struct {
+	Type string
+	Size float64
+}
+
+var errInvalidBarType = errors.New("bar type must be tick, volume, dollar or time")
+var errInvalidBarSize = errors.New("invalid bar size")
+
+func ParseBarSpec(barType string, size string) (BarSpec, error) {
+	spec := BarSpec{Type: barType}
+	var err error
+	switch barType {
+	case BarTick:
+		var n int64
+		n, err = strconv.ParseInt(size, 10, 64)
+		spec.Size = float64(n)
+	case BarTime:
+		var n int64
+		n, err = strconv.ParseInt(size, 10, 64)
+		if n > maxTimeBarSize {
+			return spec, errInvalidBarSize
+		}
+		spec.Size = float64(n)
+	case BarVolume, BarDollar:
+		spec.Size, err = strconv.ParseFloat(size, 64)
+	default:
+		return spec, errInvalidBarType
+	}
+	if err != nil || spec.Size <= 0 {
+		return spec, errInvalidBarSize
+	}
+	return spec, nil
+}
+
+// Build aggregates trades sorted by id into bars, the last bar may be unfinished.
+// Bars take the time in unix seconds of their first trade, time bars the start of
+// their period with periods without trades filled in as missing.
+func Build(trades []Trade, spec BarSpec) []candlestick.Candle {
+	if spec.Type == BarTime {
+		return timeBars(trades, int64(spec.Size))
+	}
+
+	bars := make([]candlestick.Candle, 0)
+	var bar *candlestick.Candle
+	filled := 0.0
+	for _, t := range trades {
+		if bar == nil {
+			bar = open(t, t.Time/1000)
+			filled = 0
+		}
+		add(bar, t)
+
+		switch spec.Type {
+		case BarTick:
+			filled += float64(t.Count())
+		case BarVolume:
+			filled += t.Quantity
+		case BarDollar:
+			filled += t.Quantity * t.Price
+		}
+		if filled >= spec.Size {
+			bars = append(bars, *bar)
+			bar = nil
+		}
+	}
+	if bar != nil {
+		bars = append(bars, *bar)
+	}
+	return bars
+}
+
+func timeBars(trades []Trade, size int64) []candlestick.Candle {
+	bars := make([]candlestick.Candle, 0)
+	for _, t := range trades {
+		start := t.Time / 1000 / size * size
+		if n := len(bars); n > 0 && bars[n-1].Time == start {
+			add(&bars[n-1], t)
+			continue
+		}
+		if n := len(bars); n > 0 {
+			for gap := bars[n-1].Time + size; gap < start; gap += size {
+				bars = append(bars, candlestick.Candle{Time: gap, Missing: true})
+			}
+		}
+		bar := open(t, start)
+		add(bar, t)
+		bars = append(bars, *bar)
+	}
+	return bars
+}
+
+func open(t Trade, time int64) *candlestick.Candle {
+	return &candlestick.Candle{Open: t.Price, High: t.Price, Low: t.Price, Time: time}
+}
+
+// add extends bar with t, taker volume counts the quote asset bought by takers
+// like it does for klines
+func add(bar *candlestick.Candle, t Trade) {
+	if t.Price > bar.High {
+		bar.High = t.Price
+	}
+	if t.Price < bar.Low {
+		bar.Low = t.Price
+	}
+	bar.Close = t.Price
+	bar.Volume += t.Quantity
+	bar.NumberOfTrades += t.Count()
+	if !t.BuyerMaker {
+		bar.TakerVolume += t.Quantity * t.Price
+	}
+}
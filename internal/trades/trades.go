@@ -0,0 +1,18 @@
+package trades
+
+// Trade is an aggregated trade, all fills of one taker order at the same price.
+// Time is in unix milliseconds.
+type Trade struct {
+	Id           int64   `json:"id"`
+	Price        float64 `json:"price"`
+	Quantity     float64 `json:"quantity"`
+	FirstTradeId int64   `json:"firstTradeId"`
+	LastTradeId  int64   `json:"lastTradeId"`
+	Time         int64   `json:"time"`
+	BuyerMaker   bool    `json:"buyerMaker"`
+}
+
+// Count returns the number of individual trades aggregated into t
+func (t Trade) Count() int64 {
+	return t.LastTradeId - t.FirstTradeId + 1
+}
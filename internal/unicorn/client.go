@@ -0,0 +1,30 @@
+package unicorn
+
+import (
+	"errors"
+	"marlin/internal/config"
+	"net/http"
+	"net/url"
+)
+
+var httpClient = http.DefaultClient
+var baseURL = config.UnicornAPI
+
+// Configure routes all EOD calls through client, an empty base url keeps the default
+func Configure(client *http.Client, url string) {
+	httpClient = client
+	if url != "" {
+		baseURL = url
+	}
+}
+
+// do sends req, transport errors lose the query of their url so the api token does
+// not end up in logs
+func do(req *http.Request) (*http.Response, error) {
+	resp, err := httpClient.Do(req)
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		urlErr.URL = req.URL.Scheme + "://" + req.URL.Host + req.URL.Path
+	}
+	return resp, err
+}
@@ -1,38 +1,63 @@
 package unicorn
 
 import (
+	"context"
 	"encoding/csv"
 	"errors"
 	"fmt"
 	"github.com/godoji/candlestick"
+	"go.opentelemetry.io/otel/attribute"
 	"io"
 	"marlin/internal/config"
 	"marlin/internal/throw"
+	"marlin/internal/tracing"
 	"net/http"
 	"strconv"
 	"time"
 )
 
-func FetchHistorical(target candlestick.AssetIdentifier) ([]candlestick.Candle, throw.Exception) {
-	candles, err := fetchHistoricalRaw(target)
+// errNotFound is returned when EOD does not know the ticker
+var errNotFound = errors.New("ticker not found")
+
+func FetchHistorical(ctx context.Context, target candlestick.AssetIdentifier) ([]candlestick.Candle, throw.Exception) {
+	candles, err := fetchHistoricalRaw(ctx, target)
 	if err != nil {
-		return nil, throw.New(err, throw.ErrKindUnexpected)
+		if errors.Is(err, errNotFound) {
+			return nil, throw.ErrNotFound.WithBroker(config.SourceUnicorn)
+		}
+		if ex := throw.FromContext(ctx); ex != nil {
+			return nil, ex.WithBroker(config.SourceUnicorn)
+		}
+		return nil, throw.New(err, throw.ErrKindUnexpected).WithBroker(config.SourceUnicorn)
 	}
 	return candles, nil
 }
 
-func fetchHistoricalRaw(target candlestick.AssetIdentifier) ([]candlestick.Candle, error) {
-	url := fmt.Sprintf("%s/eod/%s.%s?api_token=%s&period=d", config.UnicornAPI, target.Symbol, target.Exchange, config.ServiceConfig().UnicornKey())
-	req, err := http.Get(url)
+func fetchHistoricalRaw(ctx context.Context, target candlestick.AssetIdentifier) (candles []candlestick.Candle, err error) {
+	ctx, span := tracing.Start(ctx, "unicorn.eod",
+		attribute.String("broker", config.SourceUnicorn),
+		attribute.String("exchange", target.Exchange),
+		attribute.String("symbol", target.Symbol),
+	)
+	defer func() { tracing.End(span, err) }()
+
+	url := fmt.Sprintf("%s/eod/%s.%s?api_token=%s&period=d", baseURL, target.Symbol, target.Exchange, config.ServiceConfig().UnicornKey())
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
 		return nil, err
 	}
+	req, err := do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer req.Body.Close()
+	if req.StatusCode == http.StatusNotFound {
+		return nil, errNotFound
+	}
 	if req.StatusCode != http.StatusOK {
 		return nil, errors.New(req.Status)
 	}
 
-	defer req.Body.Close()
-
 	reader := csv.NewReader(req.Body)
 	_, err = reader.Read()
 	if err != nil {
@@ -41,7 +66,7 @@ func fetchHistoricalRaw(target candlestick.AssetIdentifier) ([]candlestick.Candl
 
 	currentDateSet := false
 	currentDate := time.Now()
-	candles := make([]candlestick.Candle, 0)
+	candles = make([]candlestick.Candle, 0)
 	for true {
 		line, err := reader.Read()
 		if err == io.EOF {
@@ -0,0 +1,75 @@
+package unicorn
+
+import (
+	"context"
+	"github.com/godoji/candlestick"
+	"marlin/internal/fixture"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	// fixtures are looked up relative to the repository root
+	if err := os.Chdir("../.."); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+func date(s string) int64 {
+	t, err := time.ParseInLocation("2006-01-02", s, time.UTC)
+	if err != nil {
+		panic(err)
+	}
+	return t.Unix()
+}
+
+func TestFetchHistoricalRawGaps(t *testing.T) {
+	Configure(&http.Client{Transport: &fixture.Transport{Dir: "./testdata/fixtures", Mode: fixture.ModeReplay}}, "")
+
+	candles, err := fetchHistoricalRaw(context.Background(), candlestick.NewAssetIdentifier("UNICORN", "US", "AAPL"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(candles) == 0 || candles[0].Time != date("2015-01-02") {
+		t.Fatalf("history does not start at the listing")
+	}
+	for i := 1; i < len(candles); i++ {
+		if candles[i].Time-candles[i-1].Time != candlestick.Interval1d {
+			t.Fatalf("candle %d at %d does not follow %d by a day", i, candles[i].Time, candles[i-1].Time)
+		}
+	}
+	byTime := make(map[int64]candlestick.Candle, len(candles))
+	for _, c := range candles {
+		byTime[c.Time] = c
+	}
+
+	tests := []struct {
+		name    string
+		date    string
+		missing bool
+	}{
+		{name: "first trading day", date: "2015-01-02"},
+		{name: "saturday", date: "2015-01-03", missing: true},
+		{name: "sunday", date: "2015-01-04", missing: true},
+		{name: "monday", date: "2015-01-05"},
+		{name: "outage", date: "2020-03-16", missing: true},
+		{name: "after outage", date: "2020-03-17"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c, ok := byTime[date(test.date)]
+			if !ok {
+				t.Fatalf("no candle at %s", test.date)
+			}
+			if c.Missing != test.missing {
+				t.Errorf("candle at %s missing is %v, want %v", test.date, c.Missing, test.missing)
+			}
+			if !c.Missing && (c.Open <= 0 || c.High < c.Low) {
+				t.Errorf("candle at %s has invalid prices %+v", test.date, c)
+			}
+		})
+	}
+}
@@ -1,11 +1,14 @@
 package unicorn
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/godoji/candlestick"
-	"log"
+	"go.opentelemetry.io/otel/attribute"
 	"marlin/internal/config"
+	"marlin/internal/logger"
+	"marlin/internal/tracing"
 	"math"
 	"net/http"
 	"strconv"
@@ -13,9 +16,9 @@ import (
 	"time"
 )
 
-func GetInfo() *candlestick.ExchangeInfo {
+func GetInfo(ctx context.Context) (*candlestick.ExchangeInfo, error) {
 
-	log.Println("fetch binance spot exchange info")
+	logger.Ctx(ctx).Info("fetch exchange info", logger.F("broker", config.SourceUnicorn), logger.F("exchange", "US"))
 
 	result := &candlestick.ExchangeInfo{
 		Name:       "USA Stocks",
@@ -39,11 +42,15 @@ func GetInfo() *candlestick.ExchangeInfo {
 			Constraints:        candlestick.TradeConstraints{},
 			OnBoardDate:        math.MinInt64,
 		}
-		info.Splits = GetSplits(info.Identifier)
+		splits, err := GetSplits(ctx, info.Identifier)
+		if err != nil {
+			return nil, err
+		}
+		info.Splits = splits
 		result.Symbols[info.Identifier.ToString()] = info
 	}
 
-	return result
+	return result, nil
 }
 
 type SplitResponse struct {
@@ -51,17 +58,22 @@ type SplitResponse struct {
 	Split string `json:"split"`
 }
 
-func GetSplits(target candlestick.AssetIdentifier) []candlestick.AssetSplit {
+func GetSplits(ctx context.Context, target candlestick.AssetIdentifier) (results []candlestick.AssetSplit, err error) {
+
+	ctx, span := tracing.Start(ctx, "unicorn.splits", attribute.String("symbol", target.Symbol))
+	defer func() { tracing.End(span, err) }()
 
-	url := fmt.Sprintf("%s/splits/%s.%s?api_token=%s&fmt=json", config.UnicornAPI, target.Symbol, target.Exchange, config.ServiceConfig().UnicornKey())
-	req, err := http.Get(url)
+	url := fmt.Sprintf("%s/splits/%s.%s?api_token=%s&fmt=json", baseURL, target.Symbol, target.Exchange, config.ServiceConfig().UnicornKey())
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
-		log.Println("could not retrieve split info")
-		log.Fatalln(err)
+		return nil, err
+	}
+	req, err := do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve split info for %s: %w", target.Symbol, err)
 	}
 	if req.StatusCode != http.StatusOK {
-		log.Println("could not retrieve split info")
-		log.Fatalln(req.Status)
+		return nil, fmt.Errorf("could not retrieve split info for %s: %s", target.Symbol, req.Status)
 	}
 
 	defer req.Body.Close()
@@ -70,25 +82,27 @@ func GetSplits(target candlestick.AssetIdentifier) []candlestick.AssetSplit {
 
 	err = json.NewDecoder(req.Body).Decode(&payload)
 	if err != nil {
-		log.Println("failed to decode splits")
-		log.Fatalln(err)
+		return nil, fmt.Errorf("failed to decode splits for %s: %w", target.Symbol, err)
 	}
 
-	results := make([]candlestick.AssetSplit, 0)
+	results = make([]candlestick.AssetSplit, 0)
 	for _, entry := range payload {
 		ts, err := time.Parse("2006-01-02", entry.Date)
 		if err != nil {
-			log.Fatalln("could not parse split date")
+			return nil, fmt.Errorf("could not parse split date %q: %w", entry.Date, err)
 		}
 
 		splitParts := strings.Split(entry.Split, "/")
+		if len(splitParts) != 2 {
+			return nil, fmt.Errorf("could not decode split ratio %q", entry.Split)
+		}
 		n, err := strconv.ParseFloat(splitParts[0], 64)
 		if err != nil {
-			log.Fatalln("could not decode split ratio float")
+			return nil, fmt.Errorf("could not decode split ratio %q: %w", entry.Split, err)
 		}
 		d, err := strconv.ParseFloat(splitParts[1], 64)
 		if err != nil {
-			log.Fatalln("could not decode split ratio float")
+			return nil, fmt.Errorf("could not decode split ratio %q: %w", entry.Split, err)
 		}
 
 		results = append(results, candlestick.AssetSplit{
@@ -97,5 +111,5 @@ func GetSplits(target candlestick.AssetIdentifier) []candlestick.AssetSplit {
 		})
 	}
 
-	return results
+	return results, nil
 }
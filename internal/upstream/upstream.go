@@ -0,0 +1,33 @@
+package upstream
+
+import (
+	"fmt"
+	"marlin/internal/binance"
+	"marlin/internal/coinbase"
+	"marlin/internal/config"
+	"marlin/internal/fixture"
+	"marlin/internal/logger"
+	"marlin/internal/unicorn"
+	"net/http"
+)
+
+// Setup points the broker packages at the configured base urls and installs the
+// record or replay transport
+func Setup() error {
+	c := config.ServiceConfig().Upstream()
+
+	client := http.DefaultClient
+	switch c.Mode {
+	case fixture.ModeLive:
+	case fixture.ModeRecord, fixture.ModeReplay:
+		client = &http.Client{Transport: &fixture.Transport{Dir: c.FixtureDir, Mode: c.Mode}}
+		logger.Warn("upstream fixtures enabled", logger.F("mode", c.Mode), logger.F("dir", c.FixtureDir))
+	default:
+		return fmt.Errorf("unknown upstream mode %q", c.Mode)
+	}
+
+	binance.Configure(client, c.BinanceSpotURL, c.BinanceFuturesURL)
+	unicorn.Configure(client, c.UnicornURL)
+	coinbase.Configure(client, c.CoinbaseURL)
+	return nil
+}
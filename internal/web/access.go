@@ -0,0 +1,27 @@
+package web
+
+import (
+	"github.com/urfave/negroni"
+	"marlin/internal/logger"
+	"net/http"
+	"time"
+)
+
+// AccessLog writes one structured entry per request once it has been served
+func AccessLog(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	start := time.Now()
+
+	next(w, r)
+
+	fields := []logger.Field{
+		logger.F("method", r.Method),
+		logger.F("path", r.URL.Path),
+		logger.F("query", r.URL.RawQuery),
+		logger.F("remote", r.RemoteAddr),
+		logger.F("duration", time.Since(start).String()),
+	}
+	if rw, ok := w.(negroni.ResponseWriter); ok {
+		fields = append(fields, logger.F("status", rw.Status()), logger.F("bytes", rw.Size()))
+	}
+	logger.Ctx(r.Context()).Info("request served", fields...)
+}
@@ -0,0 +1,65 @@
+package web
+
+import (
+	"marlin/internal/auth"
+	"marlin/internal/throw"
+	"net/http"
+	"strings"
+)
+
+// routes which cost upstream weight or credits and count towards the daily quota
+var costlyRouteSuffixes = []string{"/historical", "/latest", "/export", "/depth", "/trades", "/bars", "/indicators"}
+
+// isCostlyRoute also counts creating backfill jobs, a single job can fetch the
+// history of a whole exchange
+func isCostlyRoute(r *http.Request) bool {
+	if r.Method == http.MethodPost && r.URL.Path == "/jobs" {
+		return true
+	}
+	for _, suffix := range costlyRouteSuffixes {
+		if strings.HasSuffix(r.URL.Path, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+func apiKeyFromRequest(r *http.Request) string {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+	if bearer := r.Header.Get("Authorization"); strings.HasPrefix(bearer, "Bearer ") {
+		return strings.TrimPrefix(bearer, "Bearer ")
+	}
+	return ""
+}
+
+// Authenticate rejects requests without a known api key and enforces the per key
+// rate limit and daily quota, it is a no-op when no key file is configured
+func Authenticate(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+
+	if !auth.IsEnabled() {
+		next(w, r)
+		return
+	}
+
+	client, ok := auth.Lookup(apiKeyFromRequest(r))
+	if !ok {
+		throw.HttpError(w, r, throw.ErrUnauthorized)
+		return
+	}
+
+	if allowed, wait := client.Allow(); !allowed {
+		throw.HttpError(w, r, throw.ErrRateLimited.WithRetryAfter(wait))
+		return
+	}
+
+	if isCostlyRoute(r) {
+		if allowed, wait := client.Consume(); !allowed {
+			throw.HttpError(w, r, throw.ErrQuotaExceeded.WithRetryAfter(wait))
+			return
+		}
+	}
+
+	next(w, r)
+}
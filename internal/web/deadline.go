@@ -0,0 +1,22 @@
+package web
+
+import (
+	"context"
+	"marlin/internal/config"
+	"net/http"
+)
+
+// withDeadline bounds the request context of h by the deadline configured for route,
+// upstream calls derive from this context and are cancelled once it expires
+func withDeadline(route string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		d := config.ServiceConfig().Deadline(route)
+		if d <= 0 {
+			h(w, r)
+			return
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), d)
+		defer cancel()
+		h(w, r.WithContext(ctx))
+	}
+}
@@ -4,14 +4,32 @@ import (
 	"github.com/godoji/candlestick"
 	"github.com/gorilla/mux"
 	"marlin/internal/arbiter"
+	"marlin/internal/composite"
+	"marlin/internal/config"
+	"marlin/internal/gaps"
+	"marlin/internal/logger"
+	"marlin/internal/quality"
 	"marlin/internal/requests"
 	"marlin/internal/throw"
 	"net/http"
 	"strconv"
 )
 
+// header holding the number of anomalies found in the returned candles
+const anomaliesHeader = "X-Candle-Anomalies"
+
 type CandlesPayload struct {
-	Candles []candlestick.Candle `json:"candles"`
+	Candles   []candlestick.Candle `json:"candles"`
+	Anomalies []quality.Anomaly    `json:"anomalies,omitempty"`
+	Sources   []composite.Span     `json:"sources,omitempty"`
+}
+
+func (p CandlesPayload) CandleList() []candlestick.Candle {
+	return p.Candles
+}
+
+func (p CandlesPayload) HasSources() bool {
+	return len(p.Sources) > 0
 }
 
 func HandleGetLatest(w http.ResponseWriter, r *http.Request) {
@@ -19,25 +37,32 @@ func HandleGetLatest(w http.ResponseWriter, r *http.Request) {
 	// Parse source parameter
 	target, ok := candlestick.ParseSymbol(mux.Vars(r)["uuid"])
 	if !ok {
-		throw.HttpError(w, throw.ErrInvalidSymbol)
+		throw.HttpError(w, r, throw.ErrInvalidSymbol)
 		return
 	}
 
 	// Parse from parameter
 	from, err := strconv.ParseInt(r.URL.Query().Get("from"), 10, 64)
 	if err != nil {
-		throw.HttpError(w, throw.ErrInvalidFromParameter)
+		throw.HttpError(w, r, throw.ErrInvalidFromParameter)
 		return
 	}
 
-	// Fetch candles
-	candles, ex := arbiter.FetchLatest(target, from)
+	// Fetch candles, composite sources also report where they came from
+	var candles []candlestick.Candle
+	var sources []composite.Span
+	var ex throw.Exception
+	if target.Broker == config.SourceComposite {
+		candles, sources, ex = arbiter.FetchCompositeLatest(r.Context(), target, from)
+	} else {
+		candles, ex = arbiter.FetchLatest(r.Context(), target, from)
+	}
 	if ex != nil {
-		throw.HttpError(w, ex)
+		throw.HttpError(w, r, ex)
 		return
-	} else {
-		requests.SendResponse(w, r, CandlesPayload{candles})
 	}
+
+	sendCandles(w, r, target, candles, sources)
 }
 
 func HandleGetHistorical(w http.ResponseWriter, r *http.Request) {
@@ -45,7 +70,7 @@ func HandleGetHistorical(w http.ResponseWriter, r *http.Request) {
 	// Parse source parameter
 	target, ok := candlestick.ParseSymbol(mux.Vars(r)["uuid"])
 	if !ok {
-		throw.HttpError(w, throw.ErrInvalidSymbol)
+		throw.HttpError(w, r, throw.ErrInvalidSymbol)
 		return
 	}
 
@@ -55,7 +80,7 @@ func HandleGetHistorical(w http.ResponseWriter, r *http.Request) {
 		var err error
 		from, err = strconv.ParseInt(s, 10, 64)
 		if err != nil {
-			throw.HttpError(w, throw.ErrInvalidFromParameter)
+			throw.HttpError(w, r, throw.ErrInvalidFromParameter)
 			return
 		}
 	}
@@ -66,22 +91,254 @@ func HandleGetHistorical(w http.ResponseWriter, r *http.Request) {
 		var err error
 		interval, err = strconv.ParseInt(s, 10, 64)
 		if err != nil {
-			throw.HttpError(w, throw.ErrInvalidInterval)
+			throw.HttpError(w, r, throw.ErrInvalidInterval)
 			return
 		}
 	} else {
-		throw.HttpError(w, throw.ErrInvalidInterval)
+		throw.HttpError(w, r, throw.ErrInvalidInterval)
 		return
 	}
 
-	// Fetch candles
-	candles, ex := arbiter.FetchHistorical(target, from, interval)
+	// Parse bars parameter before fetching anything
+	var bars arbiter.BarTransform
+	if s := r.URL.Query().Get("bars"); s != "" {
+		var err error
+		if bars, err = arbiter.ParseBarTransform(s); err != nil {
+			throw.HttpError(w, r, throw.Wrap(err, throw.ErrInvalidBars))
+			return
+		}
+		// only Heikin-Ashi bars keep the candle times the sources of composite candles
+		// refer to
+		if target.Broker == config.SourceComposite && bars.Type != arbiter.BarsHeikinAshi {
+			throw.HttpError(w, r, throw.ErrCompositeNotSupported)
+			return
+		}
+	}
+
+	// Fetch candles, composite sources also report where they came from
+	var candles []candlestick.Candle
+	var sources []composite.Span
+	var ex throw.Exception
+	if target.Broker == config.SourceComposite {
+		candles, sources, ex = arbiter.FetchCompositeHistorical(r.Context(), target, from, interval)
+	} else {
+		candles, ex = arbiter.FetchHistorical(r.Context(), target, from, interval)
+	}
 	if ex != nil {
-		throw.HttpError(w, ex)
+		throw.HttpError(w, r, ex)
+		return
+	}
+
+	// Convert into another currency if requested
+	if currency := r.URL.Query().Get("quote"); currency != "" {
+		if candles, ex = arbiter.ConvertQuote(r.Context(), target, candles, interval, currency); ex != nil {
+			throw.HttpError(w, r, ex)
+			return
+		}
+	}
+
+	// Drop gap candles if requested
+	if r.URL.Query().Get("missing") == "drop" {
+		candles = arbiter.DropMissing(candles)
+	}
+
+	// Derive other bars if requested, anomalies are still reported for the candles
+	// the bars are built from
+	if bars.Type != "" {
+		transformed, err := arbiter.TransformBars(candles, bars)
+		if err != nil {
+			throw.HttpError(w, r, throw.Wrap(err, throw.ErrInvalidBars))
+			return
+		}
+		anomalies := quality.Validate(r.Context(), target, candles)
+		w.Header().Set(anomaliesHeader, strconv.Itoa(len(anomalies)))
+		requests.SendResponse(w, r, CandlesPayload{Candles: transformed, Anomalies: anomalies, Sources: sources})
+		return
+	}
+
+	sendCandles(w, r, target, candles, sources)
+}
+
+// sendCandles validates candles and sends them along with the anomalies found and the
+// sources of composite candles
+func sendCandles(w http.ResponseWriter, r *http.Request, target candlestick.AssetIdentifier, candles []candlestick.Candle, sources []composite.Span) {
+	anomalies := quality.Validate(r.Context(), target, candles)
+	w.Header().Set(anomaliesHeader, strconv.Itoa(len(anomalies)))
+	requests.SendResponse(w, r, CandlesPayload{Candles: candles, Anomalies: anomalies, Sources: sources})
+}
+
+func HandleGetExport(w http.ResponseWriter, r *http.Request) {
+
+	// Parse source parameter
+	target, ok := candlestick.ParseSymbol(mux.Vars(r)["uuid"])
+	if !ok {
+		throw.HttpError(w, r, throw.ErrInvalidSymbol)
+		return
+	}
+
+	// Exported tables have no column for the sources of composite candles
+	if target.Broker == config.SourceComposite {
+		throw.HttpError(w, r, throw.ErrCompositeNotSupported)
+		return
+	}
+
+	// Parse from parameter
+	from, err := strconv.ParseInt(r.URL.Query().Get("from"), 10, 64)
+	if err != nil {
+		throw.HttpError(w, r, throw.ErrInvalidFromParameter)
+		return
+	}
+
+	// Parse to parameter
+	to, err := strconv.ParseInt(r.URL.Query().Get("to"), 10, 64)
+	if err != nil || to <= from {
+		throw.HttpError(w, r, throw.ErrInvalidToParameter)
+		return
+	}
+
+	// Parse interval parameter
+	interval, err := strconv.ParseInt(r.URL.Query().Get("interval"), 10, 64)
+	if err != nil {
+		throw.HttpError(w, r, throw.ErrInvalidInterval)
+		return
+	}
+
+	// Negotiate output format before fetching anything
+	stream, ok := requests.NewCandleStream(w, r)
+	if !ok {
+		w.WriteHeader(http.StatusNotAcceptable)
+		return
+	}
+
+	// Stream candles block by block
+	dropMissing := r.URL.Query().Get("missing") == "drop"
+	currency := r.URL.Query().Get("quote")
+	var convertEx throw.Exception
+	ex := arbiter.WalkHistorical(r.Context(), target, from, to, interval, func(candles []candlestick.Candle) bool {
+		// headers are gone by the time later blocks arrive, anomalies are only logged
+		quality.Validate(r.Context(), target, candles)
+		if currency != "" {
+			if candles, convertEx = arbiter.ConvertQuote(r.Context(), target, candles, interval, currency); convertEx != nil {
+				return false
+			}
+		}
+		if dropMissing {
+			candles = arbiter.DropMissing(candles)
+		}
+		return stream.Write(candles) == nil
+	})
+
+	// Errors can only be reported before streaming started
+	if ex == nil {
+		ex = convertEx
+	}
+	if ex != nil {
+		if !stream.Started() {
+			throw.HttpError(w, r, ex)
+			return
+		}
+		logger.Ctx(r.Context()).Warn("export aborted", logger.F("symbol", target.ToString()), logger.F("error", ex))
+	}
+	_ = stream.Close()
+}
+
+func HandleGetDepth(w http.ResponseWriter, r *http.Request) {
+
+	// Parse source parameter
+	target, ok := candlestick.ParseSymbol(mux.Vars(r)["uuid"])
+	if !ok {
+		throw.HttpError(w, r, throw.ErrInvalidSymbol)
+		return
+	}
+
+	// Parse limit parameter
+	limit := 100
+	if s := r.URL.Query().Get("limit"); s != "" {
+		var err error
+		if limit, err = strconv.Atoi(s); err != nil || limit < 1 || limit > 5000 {
+			throw.HttpError(w, r, throw.ErrInvalidLimit)
+			return
+		}
+	}
+
+	// Serve a recorded snapshot when a time is given
+	if s := r.URL.Query().Get("at"); s != "" {
+		at, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			throw.HttpError(w, r, throw.ErrInvalidAtParameter)
+			return
+		}
+		snapshot, ex := arbiter.DepthAt(target, at)
+		if ex != nil {
+			throw.HttpError(w, r, ex)
+			return
+		}
+		if len(snapshot.Bids) > limit {
+			snapshot.Bids = snapshot.Bids[:limit]
+		}
+		if len(snapshot.Asks) > limit {
+			snapshot.Asks = snapshot.Asks[:limit]
+		}
+		requests.SendResponse(w, r, snapshot)
+		return
+	}
+
+	snapshot, ex := arbiter.FetchDepth(r.Context(), target, limit)
+	if ex != nil {
+		throw.HttpError(w, r, ex)
+		return
+	}
+	requests.SendResponse(w, r, snapshot)
+}
+
+type GapsPayload struct {
+	Gaps []gaps.Gap `json:"gaps"`
+}
+
+// parseGapRange reads the optional from and to parameters of the gap reports
+func parseGapRange(r *http.Request) (int64, int64, throw.Exception) {
+	from, to := int64(0), int64(0)
+	if s := r.URL.Query().Get("from"); s != "" {
+		var err error
+		if from, err = strconv.ParseInt(s, 10, 64); err != nil {
+			return 0, 0, throw.ErrInvalidFromParameter
+		}
+	}
+	if s := r.URL.Query().Get("to"); s != "" {
+		var err error
+		if to, err = strconv.ParseInt(s, 10, 64); err != nil || to <= from {
+			return 0, 0, throw.ErrInvalidToParameter
+		}
+	}
+	return from, to, nil
+}
+
+func HandleGetGaps(w http.ResponseWriter, r *http.Request) {
+
+	// Parse source parameter
+	target, ok := candlestick.ParseSymbol(mux.Vars(r)["uuid"])
+	if !ok {
+		throw.HttpError(w, r, throw.ErrInvalidSymbol)
+		return
+	}
+
+	from, to, ex := parseGapRange(r)
+	if ex != nil {
+		throw.HttpError(w, r, ex)
+		return
+	}
+
+	requests.SendResponse(w, r, GapsPayload{gaps.Find(target, from, to)})
+}
+
+func HandleGetAllGaps(w http.ResponseWriter, r *http.Request) {
+	from, to, ex := parseGapRange(r)
+	if ex != nil {
+		throw.HttpError(w, r, ex)
 		return
-	} else {
-		requests.SendResponse(w, r, CandlesPayload{candles})
 	}
+
+	requests.SendResponse(w, r, GapsPayload{gaps.Find(nil, from, to)})
 }
 
 func HandleGetInfo(w http.ResponseWriter, r *http.Request) {
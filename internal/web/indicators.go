@@ -0,0 +1,59 @@
+package web
+
+import (
+	"github.com/godoji/candlestick"
+	"github.com/gorilla/mux"
+	"marlin/internal/arbiter"
+	"marlin/internal/indicators"
+	"marlin/internal/requests"
+	"marlin/internal/throw"
+	"net/http"
+	"strconv"
+)
+
+type IndicatorPayload struct {
+	indicators.Spec
+	Columns []string           `json:"columns"`
+	Points  []indicators.Point `json:"points"`
+}
+
+func HandleGetIndicators(w http.ResponseWriter, r *http.Request) {
+
+	// Parse source parameter
+	target, ok := candlestick.ParseSymbol(mux.Vars(r)["uuid"])
+	if !ok {
+		throw.HttpError(w, r, throw.ErrInvalidSymbol)
+		return
+	}
+
+	// Parse indicator parameters
+	q := r.URL.Query()
+	spec, err := indicators.ParseSpec(q.Get("name"), q.Get("period"), q.Get("k"))
+	if err != nil {
+		throw.HttpError(w, r, throw.Wrap(err, throw.ErrInvalidIndicator))
+		return
+	}
+
+	// Parse from parameter
+	from := int64(0)
+	if s := q.Get("from"); s != "" {
+		if from, err = strconv.ParseInt(s, 10, 64); err != nil {
+			throw.HttpError(w, r, throw.ErrInvalidFromParameter)
+			return
+		}
+	}
+
+	// Parse interval parameter
+	interval, err := strconv.ParseInt(q.Get("interval"), 10, 64)
+	if err != nil {
+		throw.HttpError(w, r, throw.ErrInvalidInterval)
+		return
+	}
+
+	points, ex := arbiter.FetchIndicator(r.Context(), target, spec, from, interval)
+	if ex != nil {
+		throw.HttpError(w, r, ex)
+		return
+	}
+	requests.SendResponse(w, r, IndicatorPayload{Spec: spec, Columns: spec.Columns(), Points: points})
+}
@@ -0,0 +1,51 @@
+package web
+
+import (
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"marlin/internal/backfill"
+	"marlin/internal/requests"
+	"marlin/internal/throw"
+	"net/http"
+)
+
+type JobsPayload struct {
+	Jobs []backfill.Job `json:"jobs"`
+}
+
+func HandlePostJob(w http.ResponseWriter, r *http.Request) {
+	spec := backfill.Spec{}
+	if err := json.NewDecoder(r.Body).Decode(&spec); err != nil {
+		throw.HttpError(w, r, throw.Wrap(err, throw.ErrInvalidJob))
+		return
+	}
+
+	job, ex := backfill.Submit(spec)
+	if ex != nil {
+		throw.HttpError(w, r, ex)
+		return
+	}
+	requests.SendResponse(w, r, job)
+}
+
+func HandleGetJobs(w http.ResponseWriter, r *http.Request) {
+	requests.SendResponse(w, r, JobsPayload{backfill.List()})
+}
+
+func HandleGetJob(w http.ResponseWriter, r *http.Request) {
+	job, ok := backfill.Get(mux.Vars(r)["id"])
+	if !ok {
+		throw.HttpError(w, r, throw.ErrNotFound)
+		return
+	}
+	requests.SendResponse(w, r, job)
+}
+
+func HandleDeleteJob(w http.ResponseWriter, r *http.Request) {
+	job, ok := backfill.Cancel(mux.Vars(r)["id"])
+	if !ok {
+		throw.HttpError(w, r, throw.ErrNotFound)
+		return
+	}
+	requests.SendResponse(w, r, job)
+}
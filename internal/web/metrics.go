@@ -0,0 +1,30 @@
+package web
+
+import (
+	"expvar"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// only the counters marlin publishes are served, expvar also publishes the command
+// line and memory statistics of the process
+const metricsPrefix = "quality_"
+
+// HandleGetMetrics writes the exported quality counters in the format of expvar
+func HandleGetMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_, _ = fmt.Fprintf(w, "{\n")
+	first := true
+	expvar.Do(func(kv expvar.KeyValue) {
+		if !strings.HasPrefix(kv.Key, metricsPrefix) {
+			return
+		}
+		if !first {
+			_, _ = fmt.Fprintf(w, ",\n")
+		}
+		first = false
+		_, _ = fmt.Fprintf(w, "%q: %s", kv.Key, kv.Value)
+	})
+	_, _ = fmt.Fprintf(w, "\n}\n")
+}
@@ -1,35 +1,85 @@
 package web
 
 import (
+	"context"
 	"github.com/gorilla/mux"
 	"github.com/urfave/negroni"
-	"log"
 	"marlin/internal/config"
+	"marlin/internal/logger"
+	"marlin/internal/throw"
+	"net"
 	"net/http"
 )
 
+// market routes take an asset identifier, synthetic ones hold a slash between their legs
+const market = "/market/{uuid:[^/]+(?:/[^/]+)?}"
+
 func router() *mux.Router {
 	r := mux.NewRouter()
-	r.HandleFunc("/market/{uuid}/historical", HandleGetHistorical).Methods("GET")
-	r.HandleFunc("/market/{uuid}/latest", HandleGetLatest).Methods("GET")
+	r.HandleFunc(market+"/historical", withDeadline(config.RouteHistorical, HandleGetHistorical)).Methods("GET")
+	r.HandleFunc(market+"/latest", withDeadline(config.RouteLatest, HandleGetLatest)).Methods("GET")
+	r.HandleFunc(market+"/export", withDeadline(config.RouteExport, HandleGetExport)).Methods("GET")
+	r.HandleFunc(market+"/indicators", withDeadline(config.RouteHistorical, HandleGetIndicators)).Methods("GET")
+	r.HandleFunc(market+"/depth", withDeadline(config.RouteDepth, HandleGetDepth)).Methods("GET")
+	r.HandleFunc(market+"/trades", withDeadline(config.RouteTrades, HandleGetTrades)).Methods("GET")
+	r.HandleFunc(market+"/trades/bars", withDeadline(config.RouteTrades, HandleGetTradeBars)).Methods("GET")
+	r.HandleFunc(market+"/gaps", HandleGetGaps).Methods("GET")
+	r.HandleFunc("/market/gaps", HandleGetAllGaps).Methods("GET")
 	r.HandleFunc("/market/info", HandleGetInfo).Methods("GET")
+	r.HandleFunc("/jobs", HandlePostJob).Methods("POST")
+	r.HandleFunc("/jobs", HandleGetJobs).Methods("GET")
+	r.HandleFunc("/jobs/{id}", HandleGetJob).Methods("GET")
+	r.HandleFunc("/jobs/{id}", HandleDeleteJob).Methods("DELETE")
+	r.HandleFunc("/debug/vars", HandleGetMetrics).Methods("GET")
+	r.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		throw.HttpError(w, r, throw.ErrNotFound)
+	})
 	return r
 }
 
-func Start() {
-
-	// Middleware and routes
+// Handler returns the REST API with its middleware
+func Handler() http.Handler {
 	app := negroni.New(negroni.NewRecovery())
+	app.UseFunc(TraceRequest)
+	app.UseFunc(AccessLog)
+	app.UseFunc(Authenticate)
 	app.UseHandler(router())
+	return app
+}
+
+// Start serves the REST API until ctx is cancelled, in-flight requests are then
+// drained for at most the configured shutdown timeout before their upstream calls
+// are cancelled
+func Start(ctx context.Context) {
+
+	// Request contexts derive from this context so they can be aborted
+	requestCtx, cancelRequests := context.WithCancel(context.Background())
+	defer cancelRequests()
 
 	// Setup server
 	server := &http.Server{
-		Addr:    ":" + config.ServiceConfig().Port(),
-		Handler: app,
+		Addr:        ":" + config.ServiceConfig().Port(),
+		Handler:     Handler(),
+		BaseContext: func(_ net.Listener) context.Context { return requestCtx },
 	}
 
-	log.Printf("listening on port %s\n", config.ServiceConfig().Port())
+	logger.Info("listening", logger.F("port", config.ServiceConfig().Port()))
+
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logger.Fatal("server stopped", logger.F("error", err))
+		}
+	}()
 
-	log.Fatal(server.ListenAndServe())
+	<-ctx.Done()
+	logger.Info("shutting down, draining requests")
+
+	drainCtx, cancelDrain := context.WithTimeout(context.Background(), config.ServiceConfig().ShutdownTimeout())
+	defer cancelDrain()
+	if err := server.Shutdown(drainCtx); err != nil {
+		logger.Warn("requests did not drain in time, cancelling", logger.F("error", err))
+		cancelRequests()
+		_ = server.Close()
+	}
 
 }
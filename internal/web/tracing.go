@@ -0,0 +1,39 @@
+package web
+
+import (
+	"github.com/urfave/negroni"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"marlin/internal/tracing"
+	"net/http"
+	"strconv"
+)
+
+// TraceRequest assigns every request a correlation id, reusing a valid id sent by
+// the client, and opens the root span of the request
+func TraceRequest(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+
+	id := r.Header.Get("X-Request-Id")
+	if !tracing.ValidRequestId(id) {
+		id = tracing.NewRequestId()
+		r.Header.Set("X-Request-Id", id)
+	}
+	w.Header().Set("X-Request-Id", id)
+
+	ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	ctx = tracing.WithRequestId(ctx, id)
+	ctx, span := tracing.Start(ctx, "HTTP "+r.Method,
+		attribute.String("http.method", r.Method),
+		attribute.String("http.target", r.URL.Path),
+	)
+	// the span also ends when a handler panics and the recovery middleware takes over
+	defer func() {
+		if rw, ok := w.(negroni.ResponseWriter); ok {
+			span.SetAttributes(attribute.String("http.status_code", strconv.Itoa(rw.Status())))
+		}
+		span.End()
+	}()
+
+	next(w, r.WithContext(ctx))
+}
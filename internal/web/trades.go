@@ -0,0 +1,140 @@
+package web
+
+import (
+	"github.com/godoji/candlestick"
+	"github.com/gorilla/mux"
+	"marlin/internal/arbiter"
+	"marlin/internal/requests"
+	"marlin/internal/throw"
+	"marlin/internal/trades"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// most trades aggregated into bars by a single request
+const maxBarTrades = 100000
+
+// TradesPayload points at the next page either by trade id or, after a long range
+// without trades, by the time to continue from
+type TradesPayload struct {
+	Trades   []trades.Trade `json:"trades"`
+	NextId   *int64         `json:"nextId,omitempty"`
+	NextFrom *int64         `json:"nextFrom,omitempty"`
+}
+
+func HandleGetTrades(w http.ResponseWriter, r *http.Request) {
+
+	// Parse source parameter
+	target, ok := candlestick.ParseSymbol(mux.Vars(r)["uuid"])
+	if !ok {
+		throw.HttpError(w, r, throw.ErrInvalidSymbol)
+		return
+	}
+
+	// Parse fromId parameter, pages after the first continue by trade id
+	fromId := int64(-1)
+	if s := r.URL.Query().Get("fromId"); s != "" {
+		var err error
+		if fromId, err = strconv.ParseInt(s, 10, 64); err != nil || fromId < 0 {
+			throw.HttpError(w, r, throw.ErrInvalidFromIdParameter)
+			return
+		}
+	}
+
+	// Parse from parameter, required without a trade id
+	from := int64(0)
+	if s := r.URL.Query().Get("from"); s != "" || fromId < 0 {
+		var err error
+		if from, err = strconv.ParseInt(s, 10, 64); err != nil {
+			throw.HttpError(w, r, throw.ErrInvalidFromParameter)
+			return
+		}
+	}
+
+	// Parse to parameter
+	to := time.Now().UTC().Unix() + 1
+	if s := r.URL.Query().Get("to"); s != "" {
+		var err error
+		if to, err = strconv.ParseInt(s, 10, 64); err != nil || (fromId < 0 && to <= from) {
+			throw.HttpError(w, r, throw.ErrInvalidToParameter)
+			return
+		}
+	}
+
+	// Parse limit parameter
+	limit := 500
+	if s := r.URL.Query().Get("limit"); s != "" {
+		var err error
+		if limit, err = strconv.Atoi(s); err != nil || limit < 1 || limit > arbiter.TradesPageSize {
+			throw.HttpError(w, r, throw.ErrInvalidLimit)
+			return
+		}
+	}
+
+	page, nextFrom, ex := arbiter.FetchTrades(r.Context(), target, fromId, from, to, limit)
+	if ex != nil {
+		throw.HttpError(w, r, ex)
+		return
+	}
+
+	// a short page by id is the last one, pages by time may be followed by trades in
+	// later hours
+	payload := TradesPayload{Trades: page}
+	if len(page) > 0 && (fromId < 0 || len(page) == limit) {
+		next := page[len(page)-1].Id + 1
+		payload.NextId = &next
+	}
+	if nextFrom > 0 {
+		payload.NextFrom = &nextFrom
+	}
+	requests.SendResponse(w, r, payload)
+}
+
+func HandleGetTradeBars(w http.ResponseWriter, r *http.Request) {
+
+	// Parse source parameter
+	target, ok := candlestick.ParseSymbol(mux.Vars(r)["uuid"])
+	if !ok {
+		throw.HttpError(w, r, throw.ErrInvalidSymbol)
+		return
+	}
+
+	// Parse bar parameters
+	spec, err := trades.ParseBarSpec(r.URL.Query().Get("type"), r.URL.Query().Get("size"))
+	if err != nil {
+		throw.HttpError(w, r, throw.Wrap(err, throw.ErrInvalidBars))
+		return
+	}
+
+	// Parse from parameter
+	from, err := strconv.ParseInt(r.URL.Query().Get("from"), 10, 64)
+	if err != nil {
+		throw.HttpError(w, r, throw.ErrInvalidFromParameter)
+		return
+	}
+
+	// Parse to parameter
+	to, err := strconv.ParseInt(r.URL.Query().Get("to"), 10, 64)
+	if err != nil || to <= from {
+		throw.HttpError(w, r, throw.ErrInvalidToParameter)
+		return
+	}
+
+	result := make([]trades.Trade, 0)
+	ex := arbiter.WalkTrades(r.Context(), target, from, to, func(page []trades.Trade) bool {
+		result = append(result, page...)
+		return len(result) <= maxBarTrades
+	})
+	if ex != nil {
+		throw.HttpError(w, r, ex)
+		return
+	}
+	if len(result) > maxBarTrades {
+		throw.HttpError(w, r, throw.ErrTooManyTrades)
+		return
+	}
+
+	// bars are built from individual trades, there is nothing for the kline checks to find
+	requests.SendResponse(w, r, CandlesPayload{Candles: trades.Build(result, spec)})
+}